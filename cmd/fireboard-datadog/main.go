@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/collector"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/logs"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/rules"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/series"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/tracing"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reset-watermarks" {
+		if err := resetWatermarks(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger := slog.Default()
+
+	shutdownTracing, err := tracing.SetupFromEnv(ctx)
+	if err != nil {
+		logger.Error("unable to setup tracing", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Warn("unable to shutdown tracing", "error", err)
+		}
+	}()
+
+	// an empty address uses DD_AGENT_HOST and DD_DOGSTATSD_PORT
+	stat, err := statsd.New(os.Getenv("FIREBOARD_STATSD_ADDR"))
+	if err != nil {
+		logger.Error("unable to create statsd client", "error", err)
+		os.Exit(1)
+	}
+
+	var tags []string
+	if val := os.Getenv("FIREBOARD_TAGS"); val != "" {
+		tags = strings.Split(val, ",")
+	}
+
+	client, err := api.NewDefaultAPIClientFromEnv()
+	if err != nil {
+		logger.Error("unable to create fireboard api client", "error", err)
+		os.Exit(1)
+	}
+	client.SetStatsd(stat, tags)
+	c := collector.NewCollector(client, stat, tags)
+	if os.Getenv("FIREBOARD_SERIES_API") == "true" {
+		sink, err := series.NewHTTPSinkFromEnv()
+		if err != nil {
+			logger.Error("unable to create series sink", "error", err)
+			os.Exit(1)
+		}
+		c.SetSeriesSink(sink)
+	}
+	c.SetHashAccessPointMAC(os.Getenv("FIREBOARD_HASH_AP_MAC") == "true")
+	if secret := os.Getenv("FIREBOARD_HASH_SECRET"); secret != "" {
+		c.SetHashSecret([]byte(secret))
+	}
+	logSink, err := logs.NewSinkFromEnv()
+	if err != nil {
+		logger.Error("unable to create logs sink", "error", err)
+		os.Exit(1)
+	}
+	if logSink != nil {
+		c.SetLogSink(logSink, logs.RedactedFieldsFromEnv())
+	}
+	onlineDefaults, onlineDevices, err := collector.NewOnlineThresholdsFromEnv()
+	if err != nil {
+		logger.Error("invalid online thresholds", "error", err)
+		os.Exit(1)
+	}
+	c.SetOnlineThresholds(onlineDefaults, onlineDevices)
+	if path := os.Getenv("FIREBOARD_SNAPSHOT_FILE"); path != "" {
+		c.SetSnapshotStore(checkpoint.NewFileSnapshotStore(path))
+	}
+	if path := os.Getenv("FIREBOARD_CHECKPOINT_FILE"); path != "" {
+		store, err := checkpoint.NewFileStore(path)
+		if err != nil {
+			logger.Error("unable to open checkpoint file", "path", path, "error", err)
+			os.Exit(1)
+		}
+		c.SetCheckpointStore(store)
+	}
+	targets, rateWindow, err := collector.NewChannelTargetsFromEnv()
+	if err != nil {
+		logger.Error("invalid channel targets", "error", err)
+		os.Exit(1)
+	}
+	c.SetChannelTargets(targets, rateWindow)
+	if path := os.Getenv("FIREBOARD_RULES_FILE"); path != "" {
+		engine, err := newRulesEngine(path)
+		if err != nil {
+			logger.Error("unable to load rules", "path", path, "error", err)
+			os.Exit(1)
+		}
+		c.SetRulesEngine(engine)
+	}
+	if err := c.Run(ctx, collector.NewConfigFromEnv()); err != nil {
+		logger.Error("collector failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// resetWatermarks removes the chart watermarks of a session so all of its points are ingested again by the next
+// collection, whatever its cutoff. A running collector applies the reset when it next saves the checkpoint file.
+func resetWatermarks(args []string) error {
+	fs := flag.NewFlagSet("reset-watermarks", flag.ContinueOnError)
+	path := fs.String("file", os.Getenv("FIREBOARD_CHECKPOINT_FILE"), "checkpoint file, defaults to FIREBOARD_CHECKPOINT_FILE")
+	sessionID := fs.Int64("session", 0, "session id to reset")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" || *sessionID == 0 {
+		fs.Usage()
+		return fmt.Errorf("a checkpoint file and session id are required")
+	}
+	store, err := checkpoint.NewFileStore(*path)
+	if err != nil {
+		return err
+	}
+	store.Reset(*sessionID)
+	return store.Save()
+}
+
+// newRulesEngine loads the rules in path with the notifiers configured in the environment.
+func newRulesEngine(path string) (*rules.Engine, error) {
+	ruleset, err := rules.LoadRules(path)
+	if err != nil {
+		return nil, err
+	}
+	notifier, err := rules.NewNotifierFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if notifier == nil {
+		return nil, fmt.Errorf("FIREBOARD_RULES_WEBHOOK_URL or FIREBOARD_SMTP_ADDR is required with FIREBOARD_RULES_FILE")
+	}
+	return rules.NewEngine(ruleset, notifier)
+}
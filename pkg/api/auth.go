@@ -1,11 +1,8 @@
 package api
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"sync"
 	"time"
@@ -15,6 +12,9 @@ const (
 	authLoginAPIPath = "api/rest-auth/login"
 )
 
+// TokenLifetime is how long an authentication token is used before it is considered expired.
+const TokenLifetime = time.Hour
+
 var ErrNoValidToken = fmt.Errorf("no valid token")
 var ErrExpiredToken = fmt.Errorf("token is expired, please renew")
 var ErrRateLimited = fmt.Errorf("rate limited response, please back off")
@@ -28,50 +28,25 @@ type authResponse struct {
 	Key string `json:"key,omitempty"`
 }
 
-// GetAuthToken will obtain a new API authentication token
-func (a *defaultApiClient) GetAuthToken(username, password string) (string, error) {
-	c := a.getHttpClient()
-	url := a.constructURL(authLoginAPIPath)
-	data, err := json.Marshal(authRequest{
-		Username: username,
-		Password: password,
-	})
-	if err != nil {
-		return "", err
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		url,
-		bytes.NewBuffer(data),
-	)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Content-Type", contentType)
-	req.Header.Add("Accept", contentType)
-	resp, err := c.Do(req)
+// GetAuthToken will obtain a new API authentication token and store it for subsequent requests
+func (a *defaultApiClient) GetAuthToken(ctx context.Context, username, password string) (string, error) {
+	var r authResponse
+	err := a.do(ctx, apiRequest{
+		endpoint: endpointAuth,
+		method:   http.MethodPost,
+		path:     authLoginAPIPath,
+		body: authRequest{
+			Username: username,
+			Password: password,
+		},
+	}, &r)
 	if err != nil {
 		return "", err
 	}
-	respData, err := io.ReadAll(resp.Body)
+	err = a.authStore.StoreToken(r.Key, time.Now().Add(TokenLifetime))
 	if err != nil {
 		return "", err
 	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return "", ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return "", fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-	var r authResponse
-	err = json.Unmarshal(respData, &r)
-	if err != nil {
-		return "", err
-	}
-
 	return r.Key, nil
 }
 
@@ -111,12 +86,12 @@ func (s *inMemoryAuthTokenStorage) GetCurrentToken() (string, error) {
 }
 
 // RenewToken renews a token with given credentials
-func (s *inMemoryAuthTokenStorage) RenewToken(client APIClient, username, password string) error {
-	newToken, err := client.GetAuthToken(username, password)
+func (s *inMemoryAuthTokenStorage) RenewToken(ctx context.Context, client APIClient, username, password string) error {
+	newToken, err := client.GetAuthToken(ctx, username, password)
 	if err != nil {
 		return err
 	}
-	err = s.StoreToken(newToken, time.Now().Add(time.Hour))
+	err = s.StoreToken(newToken, time.Now().Add(TokenLifetime))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is matched by errors.Is for every CircuitOpenError.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned without calling the API while an endpoint's circuit breaker is open.
+type CircuitOpenError struct {
+	Endpoint   string        // the endpoint name: devices, temps, drivelog, sessions, chart or auth
+	RetryAfter time.Duration // time until the breaker half-opens and allows a probe
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s endpoint is open, retry after %s", e.Endpoint, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests flow normally
+	BreakerHalfOpen                     // a single probe request is allowed through
+	BreakerOpen                         // requests fail fast
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half_open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// circuitBreaker opens after threshold consecutive failures and half-opens after cooldown.
+type circuitBreaker struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+	mu       sync.Mutex
+}
+
+func newCircuitBreaker(endpoint string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		endpoint:  endpoint,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns a *CircuitOpenError if the request must not be sent.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		elapsed := b.now().Sub(b.openedAt)
+		if elapsed < b.cooldown {
+			return &CircuitOpenError{Endpoint: b.endpoint, RetryAfter: b.cooldown - elapsed}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{Endpoint: b.endpoint}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record records the outcome of an allowed request and returns the resulting state.
+func (b *circuitBreaker) record(success bool) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.state = BreakerClosed
+		return b.state
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+	return b.state
+}
+
+// release gives back a probe slot when the request was never sent.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// State returns the current state.
+func (b *circuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
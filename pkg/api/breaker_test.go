@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, *time.Time) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("devices", threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	b, now := newTestBreaker(3, 30*time.Second)
+	for i := 0; i < 2; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+		if state := b.record(false); state != BreakerClosed {
+			t.Fatalf("failure %d: got %s, want closed below the threshold", i, state)
+		}
+	}
+	// a success resets the consecutive failures
+	b.allow()
+	b.record(true)
+	for i := 0; i < 3; i++ {
+		b.allow()
+		b.record(false)
+	}
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("got %s, want open after 3 consecutive failures", state)
+	}
+
+	*now = now.Add(10 * time.Second)
+	err := b.allow()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || open.Endpoint != "devices" || open.RetryAfter != 20*time.Second {
+		t.Errorf("got %+v, want devices retrying after 20s", open)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	b, now := newTestBreaker(1, 30*time.Second)
+	b.allow()
+	b.record(false)
+
+	*now = now.Add(30 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe after the cooldown: %v", err)
+	}
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Fatalf("got %s, want half_open", state)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second request while probing: got %v, want ErrCircuitOpen", err)
+	}
+
+	// a failed probe re-opens for a full cooldown
+	if state := b.record(false); state != BreakerOpen {
+		t.Fatalf("failed probe: got %s, want open", state)
+	}
+	*now = now.Add(29 * time.Second)
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("within the new cooldown: got %v, want ErrCircuitOpen", err)
+	}
+
+	// a successful probe closes
+	*now = now.Add(time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if state := b.record(true); state != BreakerClosed {
+		t.Fatalf("successful probe: got %s, want closed", state)
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.allow(); err != nil {
+			t.Errorf("closed breaker request %d: %v", i, err)
+		}
+	}
+}
+
+func TestCircuitBreakerReleaseReturnsProbe(t *testing.T) {
+	b, now := newTestBreaker(1, time.Second)
+	b.allow()
+	b.record(false)
+	*now = now.Add(time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	// the probe was never sent, e.g. the request budget was exhausted
+	b.release()
+	if state := b.State(); state != BreakerHalfOpen {
+		t.Fatalf("got %s, want half_open after a release", state)
+	}
+	if err := b.allow(); err != nil {
+		t.Errorf("released probe slot was not given back: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultHourlyRequestLimit is the FireBoard API limit of requests per hour per account.
+const DefaultHourlyRequestLimit = 200
+
+// ErrBudgetExhausted is returned without calling the API when the hourly request budget is used up.
+var ErrBudgetExhausted = errors.New("hourly request budget exhausted")
+
+// RequestBudget tracks requests made in a sliding one hour window against the hourly limit.
+type RequestBudget struct {
+	limit    int
+	requests []time.Time
+	total    int64 // requests taken since the budget was created
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// NewRequestBudget returns a budget allowing limit requests per hour.
+func NewRequestBudget(limit int) *RequestBudget {
+	if limit <= 0 {
+		limit = DefaultHourlyRequestLimit
+	}
+	return &RequestBudget{
+		limit: limit,
+		now:   time.Now,
+	}
+}
+
+// Limit returns the hourly request limit.
+func (b *RequestBudget) Limit() int {
+	return b.limit
+}
+
+// Take records a request made now, it returns false without recording if the budget is exhausted.
+func (b *RequestBudget) Take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	if len(b.requests) >= b.limit {
+		return false
+	}
+	b.requests = append(b.requests, b.now())
+	b.total++
+	return true
+}
+
+// Total returns the number of requests taken since the budget was created.
+func (b *RequestBudget) Total() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// Remaining returns the number of requests left in the current window, never negative.
+func (b *RequestBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	if remaining := b.limit - len(b.requests); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// expire drops requests older than an hour, the caller must hold the lock.
+func (b *RequestBudget) expire() {
+	cutoff := b.now().Add(-time.Hour)
+	i := 0
+	for i < len(b.requests) && !b.requests[i].After(cutoff) {
+		i++
+	}
+	b.requests = b.requests[i:]
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestBudgetSlidingWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	budget := NewRequestBudget(2)
+	budget.now = func() time.Time { return now }
+
+	if !budget.Take() {
+		t.Fatal("first request was not allowed")
+	}
+	now = now.Add(30 * time.Minute)
+	if !budget.Take() {
+		t.Fatal("second request was not allowed")
+	}
+	if budget.Take() {
+		t.Fatal("request over the limit was allowed")
+	}
+	if got := budget.Remaining(); got != 0 {
+		t.Errorf("got %d remaining, want 0", got)
+	}
+
+	// the first request leaves the window an hour after it was made
+	now = now.Add(30 * time.Minute)
+	if got := budget.Remaining(); got != 1 {
+		t.Errorf("got %d remaining an hour after the first request, want 1", got)
+	}
+	if !budget.Take() {
+		t.Fatal("request after the window moved was not allowed")
+	}
+	if budget.Take() {
+		t.Fatal("request over the limit was allowed")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if got := budget.Remaining(); got != 2 {
+		t.Errorf("got %d remaining after the window emptied, want 2", got)
+	}
+	if got := budget.Total(); got != 3 {
+		t.Errorf("got total %d, want 3 with refused requests not counted", got)
+	}
+}
+
+func TestNewRequestBudgetDefaultsLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		if got := NewRequestBudget(limit).Limit(); got != DefaultHourlyRequestLimit {
+			t.Errorf("NewRequestBudget(%d).Limit() = %d, want %d", limit, got, DefaultHourlyRequestLimit)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	redacted                = "REDACTED"
+	defaultDebugMaxBodySize = 2048
+)
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+var (
+	// authRequest.Password, authResponse.Key and any other token looking values
+	secretFieldRegex = regexp.MustCompile(`"(password|key|token)"\s*:\s*"[^"]*"`)
+	macAddressRegex  = regexp.MustCompile(`\b([0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}\b`)
+	// DeviceLog.InternalIP and DeviceLog.PublicIP, other dotted values such as versions are left alone
+	ipFieldRegex = regexp.MustCompile(`"(internalIP|publicIP)"(\s*:\s*)"([^"]*)"`)
+)
+
+// debugRoundTripper logs every request and response with sensitive values redacted.
+type debugRoundTripper struct {
+	next        http.RoundTripper
+	logger      *slog.Logger
+	maxBodySize int
+}
+
+// NewDebugRoundTripper wraps next and logs method, path, status, latency and truncated bodies to logger at debug level.
+// The Authorization header, passwords, tokens, MAC addresses and public IPs of the device log are redacted.
+// A maxBodySize <= 0 uses the default of 2048 bytes.
+func NewDebugRoundTripper(next http.RoundTripper, logger *slog.Logger, maxBodySize int) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if maxBodySize <= 0 {
+		maxBodySize = defaultDebugMaxBodySize
+	}
+	return &debugRoundTripper{
+		next:        next,
+		logger:      logger,
+		maxBodySize: maxBodySize,
+	}
+}
+
+func (d *debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = data
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	d.logger.Debug("fireboard api request",
+		"method", req.Method,
+		"path", req.URL.Path,
+		"headers", redactHeaders(req.Header),
+		"body", d.redactBody(reqBody),
+	)
+
+	start := time.Now()
+	resp, err := d.next.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		d.logger.Debug("fireboard api error",
+			"method", req.Method,
+			"path", req.URL.Path,
+			"latency", latency,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	d.logger.Debug("fireboard api response",
+		"method", req.Method,
+		"path", req.URL.Path,
+		"status", resp.StatusCode,
+		"latency", latency,
+		"headers", redactHeaders(resp.Header),
+		"body", d.redactBody(respBody),
+	)
+	return resp, nil
+}
+
+// redactBody redacts the whole body before truncating it, a value cut at the limit would no longer match.
+func (d *debugRoundTripper) redactBody(body []byte) string {
+	s := RedactString(string(body))
+	if len(s) > d.maxBodySize {
+		s = s[:d.maxBodySize] + "...(truncated)"
+	}
+	return s
+}
+
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range redactedHeaders {
+		if out.Get(k) != "" {
+			out.Set(k, redacted)
+		}
+	}
+	return out
+}
+
+// RedactString removes secrets, MAC addresses and public IP addresses of the known ip fields from s.
+// Private, loopback and link-local addresses are kept as they are useful for debugging.
+func RedactString(s string) string {
+	s = secretFieldRegex.ReplaceAllString(s, `"$1":"`+redacted+`"`)
+	s = macAddressRegex.ReplaceAllString(s, redacted)
+	s = ipFieldRegex.ReplaceAllStringFunc(s, func(match string) string {
+		field := ipFieldRegex.FindStringSubmatch(match)
+		ip := net.ParseIP(field[3])
+		if ip == nil || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+			return match
+		}
+		return `"` + field[1] + `"` + field[2] + `"` + redacted + `"`
+	})
+	return s
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"password", `{"username":"pitmaster","password": "hunter2"}`, `{"username":"pitmaster","password":"REDACTED"}`},
+		{"token", `{"key":"abc123","token":"def456"}`, `{"key":"REDACTED","token":"REDACTED"}`},
+		{"mac", `{"macAP":"00:00:5E:00:53:AF","macNIC":"00-00-5e-00-53-01"}`, `{"macAP":"REDACTED","macNIC":"REDACTED"}`},
+		{"public ip", `{"publicIP": "192.0.2.10"}`, `{"publicIP": "REDACTED"}`},
+		{"public ipv6", `{"publicIP":"2001:db8::1"}`, `{"publicIP":"REDACTED"}`},
+		{"private ip", `{"internalIP":"192.168.1.20","publicIP":"127.0.0.1"}`, `{"internalIP":"192.168.1.20","publicIP":"127.0.0.1"}`},
+		{"not an ip", `{"publicIP":"unknown"}`, `{"publicIP":"unknown"}`},
+		{"version", `{"version":"1.2.3.4","internalIP":"10.0.0.2"}`, `{"version":"1.2.3.4","internalIP":"10.0.0.2"}`},
+		{"address outside ip fields", `{"title":"8.8.8.8"}`, `{"title":"8.8.8.8"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactString(tt.in); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebugRoundTripperRedactsRequestsAndResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Write([]byte(`{"key":"api-token","device_log":{"publicIP":"198.51.100.7","macAP":"00:00:5e:00:53:af"}}`))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := &http.Client{Transport: NewDebugRoundTripper(nil, logger, 0)}
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/rest-auth/login/", strings.NewReader(`{"username":"pitmaster","password":"hunter2"}`))
+	req.Header.Set("Authorization", "Token api-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "198.51.100.7") {
+		t.Errorf("the response body passed on was redacted: %s", body)
+	}
+
+	out := logs.String()
+	for _, secret := range []string{"api-token", "hunter2", "session=secret", "198.51.100.7", "00:00:5e:00:53:af"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"fireboard api request", "fireboard api response", "/api/rest-auth/login/", "status=200"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("logs are missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDebugRoundTripperTruncatesBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 100))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	resp, err := (&http.Client{Transport: NewDebugRoundTripper(nil, logger, 10)}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(logs.String(), "aaaaaaaaaa...(truncated)") || strings.Contains(logs.String(), "aaaaaaaaaaa") {
+		t.Errorf("body not truncated to 10 bytes:\n%s", logs.String())
+	}
+}
+
+func TestDebugRoundTripperRedactsBeforeTruncating(t *testing.T) {
+	for _, tt := range []struct {
+		body   string
+		secret string
+	}{
+		{`{"username":"pitmaster","password":"hunter2"}`, "hunter2"},
+		{`{"key":"abc123def456"}`, "abc123def456"},
+		{`{"title":"smoker","publicIP":"203.0.113.45"}`, "203.0.113.45"},
+		{`{"title":"smoker","macAP":"00:00:5e:00:53:af"}`, "00:00:5e:00:53:af"},
+	} {
+		// the limit falls inside the secret
+		prefix := strings.Index(tt.body, tt.secret) + 6
+		d := &debugRoundTripper{maxBodySize: prefix}
+		got := d.redactBody([]byte(tt.body))
+		if strings.Contains(got, tt.secret[:6]) {
+			t.Errorf("%s: logged %q", tt.body, got)
+		}
+		if !strings.HasSuffix(got, "...(truncated)") {
+			t.Errorf("%s: not truncated: %q", tt.body, got)
+		}
+	}
+}
+
+func TestDebugEnvEnablesDebugLogging(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  bool
+	}{{"true", true}, {"false", false}, {"1", false}} {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("FIREBOARD_API_DEBUG", tt.value)
+			client := NewDefaultAPIClient()
+			_, isDebug := client.getHttpClient().Transport.(*debugRoundTripper)
+			if client.debug != tt.want || isDebug != tt.want {
+				t.Errorf("got debug %v with debug transport %v, want %v", client.debug, isDebug, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLoggerKeepsDebugLogging(t *testing.T) {
+	t.Setenv("FIREBOARD_API_DEBUG", "true")
+	client := NewDefaultAPIClient()
+	var out bytes.Buffer
+	client.SetLogger(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	transport, ok := client.getHttpClient().Transport.(*debugRoundTripper)
+	if !ok {
+		t.Fatal("the debug transport was dropped by SetLogger")
+	}
+	transport.logger.Debug("probe")
+	if !strings.Contains(out.String(), "probe") {
+		t.Error("the debug transport does not log to the injected logger")
+	}
+}
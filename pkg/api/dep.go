@@ -1,15 +1,25 @@
 package api
 
 import (
+	"context"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
 )
 
 const (
 	contentType = "application/json"
+
+	defaultMaxRetries   = 2
+	defaultRetryBackoff = time.Second
 )
 
 type APIClient interface {
@@ -21,47 +31,86 @@ type APIClient interface {
 	SetTimeout(timeout time.Duration)
 	// GetTimeout get the timeout configuration value
 	GetTimeout() time.Duration
+	// GetRequestBudget returns the hourly request budget shared by all calls
+	GetRequestBudget() *RequestBudget
+	// SetTransportConfig sets the proxy, tls and mTLS configuration, it is kept across SetTimeout calls
+	SetTransportConfig(cfg TransportConfig) error
 
-	// GetAuthToken will obtain a new authentication token
-	GetAuthToken(username, password string) (string, error)
+	// GetAuthToken will obtain a new authentication token and store it for subsequent requests
+	GetAuthToken(ctx context.Context, username, password string) (string, error)
 
 	// ListDevices will list all devices
-	ListDevices() (ListDevicesResponse, error)
+	ListDevices(ctx context.Context) (ListDevicesResponse, error)
 	// GetDevice will get a single device information
-	GetDevice(deviceUUID string) (*DevicePropertiesResponse, error)
+	GetDevice(ctx context.Context, deviceUUID string) (*DevicePropertiesResponse, error)
 	// GetRealTimeDeviceTemperature will get the latest temperature values per channel from the device using the Temps endpoint.
 	// Temperature values are included if they are less than a minute old, otherwise nothing is returned for the channel.
-	GetRealTimeDeviceTemperature(deviceUUID string) (*DevicePropertiesResponse, error)
+	GetRealTimeDeviceTemperature(ctx context.Context, deviceUUID string) (RealTimeTemperatureResponse, error)
 	// GetRealTimeDeviceDriveData will get the latest FireBoard Drive log information for your device using the Drivelog endpoint.
-	// Drive log information is returned if less than a minute old.
-	GetRealTimeDeviceDriveData(deviceUUID string) (*DevicePropertiesResponse, error)
+	// Drive log information is returned if less than a minute old, otherwise the returned log has a zero Created time.
+	GetRealTimeDeviceDriveData(ctx context.Context, deviceUUID string) (*DriveLogResponse, error)
 
 	// ListAllSessions list all sessions
-	ListAllSessions() (SessionsListResponse, error)
+	ListAllSessions(ctx context.Context) (SessionsListResponse, error)
 	// GetSession will get a specific session
-	GetSession(sessionID int64) (*SessionGetResponse, error)
+	GetSession(ctx context.Context, sessionID int64) (*SessionGetResponse, error)
 	// GetSessionChartData will get the session chart data
-	GetSessionChartData(sessionID int64) (SessionChartResponse, error)
+	GetSessionChartData(ctx context.Context, sessionID int64) (SessionChartResponse, error)
 }
 
 // AuthTokenStorage implements a storage mechanism for the auth token.
 type AuthTokenStorage interface {
 	StoreToken(token string, expiry time.Time) error
 	GetCurrentToken() (string, error)
-	RenewToken(client APIClient, username, password string) error
+	RenewToken(ctx context.Context, client APIClient, username, password string) error
 }
 
 type defaultApiClient struct {
 	baseURL    string
 	timeout    time.Duration
 	httpClient *http.Client
+	transport  http.RoundTripper
 	authStore  AuthTokenStorage
 
+	logger *slog.Logger
+	debug  bool
+
+	budget   *RequestBudget
+	breakers map[string]*circuitBreaker
+	stat     statsd.ClientInterface
+	statTags []string
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	maxRetries   int           // retries of a failed get request
+	retryBackoff time.Duration // wait before the first retry, doubled for each following one
+
+	strict bool
+	drift  *DriftReport
+
 	mu sync.RWMutex
 }
 
-// NewDefaultAPIClient returns a new defaultApiClient
+// NewDefaultAPIClient returns a new defaultApiClient using the default transport, the FIREBOARD_API_* proxy and tls
+// variables are only read by NewDefaultAPIClientFromEnv.
 func NewDefaultAPIClient() *defaultApiClient {
+	return newDefaultAPIClient(http.DefaultTransport.(*http.Transport).Clone())
+}
+
+// NewDefaultAPIClientFromEnv returns a new defaultApiClient with its transport configured from the environment, see
+// NewTransportConfigFromEnv. It returns an error if the proxy url, ca file, client certificate or tls version is invalid.
+func NewDefaultAPIClientFromEnv() (*defaultApiClient, error) {
+	transport, err := NewTransportConfigFromEnv().NewTransport()
+	if err != nil {
+		return nil, err
+	}
+	return newDefaultAPIClient(transport), nil
+}
+
+// newDefaultAPIClient returns a new defaultApiClient sending requests through transport, the rest of its
+// configuration is read from the environment.
+func newDefaultAPIClient(transport http.RoundTripper) *defaultApiClient {
 	baseURL := "https://fireboard.io"
 	if val, ok := os.LookupEnv("FIREBOARD_API_URL"); ok && val != "" {
 		baseURL = val
@@ -73,13 +122,74 @@ func NewDefaultAPIClient() *defaultApiClient {
 		}
 	}
 
-	return &defaultApiClient{
-		baseURL: baseURL,
-		timeout: timeout,
-		httpClient: &http.Client{
-			Timeout: timeout,
-		},
+	hourlyLimit := DefaultHourlyRequestLimit
+	if val, ok := os.LookupEnv("FIREBOARD_API_HOURLY_LIMIT"); ok && val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			hourlyLimit = n
+		}
+	}
+	breakerThreshold := defaultBreakerThreshold
+	if val, ok := os.LookupEnv("FIREBOARD_API_BREAKER_THRESHOLD"); ok && val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			breakerThreshold = n
+		}
+	}
+	breakerCooldown := defaultBreakerCooldown
+	if val, ok := os.LookupEnv("FIREBOARD_API_BREAKER_COOLDOWN"); ok && val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			breakerCooldown = d
+		}
+	}
+	maxRetries := defaultMaxRetries
+	if val, ok := os.LookupEnv("FIREBOARD_API_MAX_RETRIES"); ok && val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			maxRetries = n
+		}
+	}
+	retryBackoff := defaultRetryBackoff
+	if val, ok := os.LookupEnv("FIREBOARD_API_RETRY_BACKOFF"); ok && val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			retryBackoff = d
+		}
+	}
+
+	a := &defaultApiClient{
+		baseURL:   baseURL,
+		timeout:   timeout,
+		transport: transport,
 		authStore: NewInMemoryAuthTokenStorage(),
+		logger:    slog.Default(),
+		budget:    NewRequestBudget(hourlyLimit),
+		breakers:  make(map[string]*circuitBreaker),
+
+		breakerThreshold: breakerThreshold,
+		breakerCooldown:  breakerCooldown,
+
+		maxRetries:   maxRetries,
+		retryBackoff: retryBackoff,
+
+		drift: NewDriftReport(),
+	}
+	if val, ok := os.LookupEnv("FIREBOARD_API_STRICT"); ok && val == "true" {
+		a.strict = true
+	}
+	if val, ok := os.LookupEnv("FIREBOARD_API_DEBUG"); ok && val == "true" {
+		a.logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		a.debug = true
+	}
+	a.httpClient = a.newHttpClient()
+	return a
+}
+
+// newHttpClient builds the http client from the current configuration, the caller must hold the lock.
+func (a *defaultApiClient) newHttpClient() *http.Client {
+	transport := a.transport
+	if a.debug {
+		transport = NewDebugRoundTripper(transport, a.logger, 0)
+	}
+	return &http.Client{
+		Timeout:   a.timeout,
+		Transport: transport,
 	}
 }
 
@@ -94,7 +204,9 @@ func (a *defaultApiClient) constructURL(path string) string {
 	if err != nil {
 		panic(err)
 	}
+	path, query, _ := strings.Cut(path, "?")
 	u.Path = path
+	u.RawQuery = query
 	return u.String()
 }
 
@@ -122,8 +234,113 @@ func (a *defaultApiClient) GetTimeout() time.Duration {
 func (a *defaultApiClient) SetTimeout(timeout time.Duration) {
 	a.mu.Lock()
 	a.timeout = timeout
-	a.httpClient = &http.Client{
-		Timeout: timeout,
+	a.httpClient = a.newHttpClient()
+	a.mu.Unlock()
+}
+
+// SetTransportConfig sets the proxy, tls and mTLS configuration, it is kept across SetTimeout calls
+func (a *defaultApiClient) SetTransportConfig(cfg TransportConfig) error {
+	transport, err := cfg.NewTransport()
+	if err != nil {
+		return err
 	}
+	a.mu.Lock()
+	a.transport = transport
+	a.httpClient = a.newHttpClient()
 	a.mu.Unlock()
+	return nil
+}
+
+// SetLogger sets the structured logger, nil discards all logs.
+func (a *defaultApiClient) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	a.mu.Lock()
+	a.logger = logger
+	a.httpClient = a.newHttpClient()
+	a.mu.Unlock()
+}
+
+// SetDebugLogging enables redacted request and response logging at debug level.
+func (a *defaultApiClient) SetDebugLogging(enabled bool) {
+	a.mu.Lock()
+	a.debug = enabled
+	a.httpClient = a.newHttpClient()
+	a.mu.Unlock()
+}
+
+// SetStatsd enables the api self-metrics: request latency, status codes, retries, rate limits and remaining hourly budget.
+// A nil client disables them.
+func (a *defaultApiClient) SetStatsd(stat statsd.ClientInterface, tags []string) {
+	a.mu.Lock()
+	a.stat = stat
+	a.statTags = tags
+	a.mu.Unlock()
+}
+
+func (a *defaultApiClient) getStatsd() (statsd.ClientInterface, []string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.stat, a.statTags
+}
+
+// GetRequestBudget returns the hourly request budget tracker.
+func (a *defaultApiClient) GetRequestBudget() *RequestBudget {
+	return a.budget
+}
+
+// SetCircuitBreaker configures the per-endpoint circuit breakers, open after threshold consecutive failures
+// and allow a probe request after cooldown. Existing breaker state is reset.
+func (a *defaultApiClient) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	a.mu.Lock()
+	a.breakerThreshold = threshold
+	a.breakerCooldown = cooldown
+	a.breakers = make(map[string]*circuitBreaker)
+	a.mu.Unlock()
+}
+
+// SetRetries sets how many times a get request failing with a transport or server error is retried and the wait before
+// the first retry, doubled for each following one. Retries take from the request budget, 0 disables them.
+func (a *defaultApiClient) SetRetries(maxRetries int, backoff time.Duration) {
+	a.mu.Lock()
+	a.maxRetries = maxRetries
+	a.retryBackoff = backoff
+	a.mu.Unlock()
+}
+
+func (a *defaultApiClient) getRetries() (int, time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.maxRetries, a.retryBackoff
+}
+
+// GetCircuitBreakerState returns the circuit breaker state for an endpoint: devices, temps, drivelog, sessions, chart or auth.
+func (a *defaultApiClient) GetCircuitBreakerState(endpoint string) BreakerState {
+	return a.getBreaker(endpoint).State()
+}
+
+// SetStrictDecoding enables recording unknown fields and type mismatches in responses to the drift report.
+// Type mismatches no longer fail the request in strict mode.
+func (a *defaultApiClient) SetStrictDecoding(enabled bool) {
+	a.mu.Lock()
+	a.strict = enabled
+	a.mu.Unlock()
+}
+
+func (a *defaultApiClient) isStrictDecoding() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.strict
+}
+
+// GetDriftReport returns the schema drift recorded in strict decoding mode.
+func (a *defaultApiClient) GetDriftReport() *DriftReport {
+	return a.drift
 }
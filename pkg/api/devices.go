@@ -4,8 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -21,7 +22,7 @@ const (
 
 type DriveLogResponse struct {
 	DeviceID            int64     `json:"device_id,omitempty"`     // maps back to DevicePropertiesResponse.ID
-	DeviceUUID          string    `json:"device_id,omitempty"`     // maps back to DevicePropertiesResponse.UUID
+	DeviceUUID          string    `json:"device_uuid,omitempty"`   // maps back to DevicePropertiesResponse.UUID
 	ModeType            string    `json:"modetype,omitempty"`      // Off or On
 	TiedChannel         int64     `json:"tiedchannel,omitempty"`   // the channel that is "tied" not sure what that means
 	DrivePercent        float32   `json:"driveper,omitempty"`      // percent [0, 1] of the drive engagement
@@ -34,6 +35,28 @@ type DriveLogResponse struct {
 	PowerMode           string    `json:"powermode,omitempty"`     // an enum of the power mode, can be N/A for offline
 }
 
+// UnmarshalJSON decodes the drive log, userinitiated may be sent as 0/1 or as a bool.
+func (d *DriveLogResponse) UnmarshalJSON(data []byte) error {
+	type driveLog DriveLogResponse
+	var raw struct {
+		driveLog
+		UserInitiated json.RawMessage `json:"userinitiated,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*d = DriveLogResponse(raw.driveLog)
+	switch string(raw.UserInitiated) {
+	case "", "null", "0", "false":
+		d.UserInitiated = false
+	case "1", "true":
+		d.UserInitiated = true
+	default:
+		return &json.UnmarshalTypeError{Value: string(raw.UserInitiated), Type: reflect.TypeOf(true), Field: "userinitiated"}
+	}
+	return nil
+}
+
 type ChannelAlertConfigResponse struct {
 	DeviceID       int64     `json:"device_id,omitempty"`      // the device id for the alert
 	ID             int64     `json:"id,omitempty"`             // alert configuration id
@@ -105,53 +128,98 @@ type DeviceLog struct {
 	CommercialMode          string    `json:"commercialMode"` // a string representation of "true" or "false"
 }
 
+// deviceLogDateLayout is the layout of DeviceLog.Date: "2022-09-01 00:36:11 UTC"
+const deviceLogDateLayout = "2006-01-02 15:04:05 MST"
+
+// UnmarshalJSON decodes the device log, accepting both the FireBoard and RFC 3339 date formats. A date in neither
+// format is left zero rather than failing the whole response, strict decoding reports it as drift.
+func (l *DeviceLog) UnmarshalJSON(data []byte) error {
+	type deviceLog DeviceLog
+	var raw struct {
+		deviceLog
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*l = DeviceLog(raw.deviceLog)
+	if date, err := parseDeviceLogDate(raw.Date); err == nil {
+		l.Date = date
+	}
+	return nil
+}
+
+// parseDeviceLogDate parses "2022-09-01 00:36:11 UTC" or RFC 3339, empty is the zero time.
+func parseDeviceLogDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(deviceLogDateLayout, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
 // CPUPercent returns cpu usage from a string to a percentage
 func (l DeviceLog) CPUPercent() float64 {
 	if l.CPUUsage == "" {
 		return 0
 	}
 
-	val, err := strconv.Atoi(strings.TrimSuffix(l.CPUUsage, "%"))
-	if err != nil {
+	val, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(l.CPUUsage, "%")), 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
 		return 0
 	}
-	return float64(val)
+	return val
 }
 
-var usageRegex = regexp.MustCompile("([0-9.]+)\D+\/([0-9.]+)\D+")
+var usageRegex = regexp.MustCompile(`([0-9.]+)\D+\/([0-9.]+)\D+`)
 
+// DiskUsagePercent returns the used fraction of the disk from "0.8M/4.0M"
 func (l DeviceLog) DiskUsagePercent() float64 {
-	if l.DiskUsage == "" {
+	return usageFraction(l.DiskUsage)
+}
+
+// MemoryUsagePercent returns the used fraction of memory from "2.7M/4.2M"
+func (l DeviceLog) MemoryUsagePercent() float64 {
+	return usageFraction(l.MemoryUsage)
+}
+
+func usageFraction(usage string) float64 {
+	if usage == "" {
 		return 0
 	}
 
-	res := usageRegex.FindAllStringSubmatch(l.DiskUsage, -1)
-	n, err := strconv.ParseFloat(res[0][1])
-	if err != nil {
+	res := usageRegex.FindAllStringSubmatch(usage, -1)
+	if len(res) == 0 {
 		return 0
 	}
-	d, err := strconv.ParseFloat(res[0][2])
+	n, err := strconv.ParseFloat(res[0][1], 64)
 	if err != nil {
 		return 0
 	}
-	return float64(n) / float64(d)
+	d, err := strconv.ParseFloat(res[0][2], 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
 }
 
-func (l DeviceLog) MemoryUsagePercent() float64 {
-	if l.MemoryUsage == "" {
+// UptimeSeconds returns the uptime in seconds from "$hours:$minutes"
+func (l DeviceLog) UptimeSeconds() float64 {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(l.Uptime), ":")
+	if !ok {
 		return 0
 	}
-
-	res := usageRegex.FindAllStringSubmatch(l.MemoryUsage, -1)
-	n, err := strconv.ParseFloat(res[0][1])
+	h, err := strconv.ParseUint(hours, 10, 32)
 	if err != nil {
 		return 0
 	}
-	d, err := strconv.ParseFloat(res[0][2])
-	if err != nil {
+	m, err := strconv.ParseUint(minutes, 10, 32)
+	if err != nil || m >= 60 {
 		return 0
 	}
-	return float64(n) / float64(d)
+	return float64(h*3600 + m*60)
 }
 
 // LinkQualityPercent will return the link quality in %
@@ -160,12 +228,15 @@ func (l DeviceLog) LinkQualityPercent() float64 {
 		return 0
 	}
 	parts := strings.Split(l.LinkQuality, "/")
+	if len(parts) != 2 {
+		return 0
+	}
 	n, err := strconv.Atoi(parts[0])
 	if err != nil {
 		return 0
 	}
 	d, err := strconv.Atoi(parts[1])
-	if err != nil {
+	if err != nil || d == 0 {
 		return 0
 	}
 	return float64(n) / float64(d)
@@ -200,170 +271,71 @@ type DevicePropertiesResponse struct {
 
 type ListDevicesResponse []DevicePropertiesResponse
 
-func (a *defaultApiClient) ListDevices() (ListDevicesResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(devicesListAPIPath)
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
+type ChannelTemperatureResponse struct {
+	Channel    int64     `json:"channel,omitempty"`    // the channel number, maps to ChannelResponse.Channel
+	Temp       float32   `json:"temp"`                 // the temperature as a function of degreeType
+	DegreeType int64     `json:"degreetype,omitempty"` // 1 = C, 2 = F
+	Created    time.Time `json:"created,omitempty"`    // the time of the reading
+}
 
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
+// RealTimeTemperatureResponse holds the latest reading per channel, channels without a reading in the last minute are omitted.
+type RealTimeTemperatureResponse []ChannelTemperatureResponse
 
+func (a *defaultApiClient) ListDevices(ctx context.Context) (ListDevicesResponse, error) {
 	var deviceResp ListDevicesResponse
-	err = json.Unmarshal(respData, &deviceResp)
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointDevices,
+		method:        http.MethodGet,
+		path:          devicesListAPIPath,
+		authenticated: true,
+	}, &deviceResp)
 	if err != nil {
 		return nil, err
 	}
 	return deviceResp, nil
 }
 
-func (a *defaultApiClient) GetDevice(deviceUUID string) (*DevicePropertiesResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(fmt.Sprintf(deviceGetAPIPath, deviceUUID))
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
+func (a *defaultApiClient) GetDevice(ctx context.Context, deviceUUID string) (*DevicePropertiesResponse, error) {
 	var deviceResp DevicePropertiesResponse
-	err = json.Unmarshal(respData, &deviceResp)
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointDevices,
+		method:        http.MethodGet,
+		path:          fmt.Sprintf(deviceGetAPIPath, deviceUUID),
+		authenticated: true,
+		attrs:         []interface{}{"device_uuid", deviceUUID},
+	}, &deviceResp)
 	if err != nil {
 		return nil, err
 	}
 	return &deviceResp, nil
 }
 
-func (a *defaultApiClient) GetRealTimeDeviceTemperature(deviceUUID string) (*DevicePropertiesResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(fmt.Sprintf(deviceTempAPIPath, deviceUUID))
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
-	var deviceResp DevicePropertiesResponse
-	err = json.Unmarshal(respData, &deviceResp)
+func (a *defaultApiClient) GetRealTimeDeviceTemperature(ctx context.Context, deviceUUID string) (RealTimeTemperatureResponse, error) {
+	var tempResp RealTimeTemperatureResponse
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointTemps,
+		method:        http.MethodGet,
+		path:          fmt.Sprintf(deviceTempAPIPath, deviceUUID),
+		authenticated: true,
+		attrs:         []interface{}{"device_uuid", deviceUUID},
+	}, &tempResp)
 	if err != nil {
 		return nil, err
 	}
-	return &deviceResp, nil
+	return tempResp, nil
 }
 
-func (a *defaultApiClient) GetRealTimeDeviceDriveData(deviceUUID string) (*DevicePropertiesResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(fmt.Sprintf(deviceDriveAPIPath, deviceUUID))
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
+func (a *defaultApiClient) GetRealTimeDeviceDriveData(ctx context.Context, deviceUUID string) (*DriveLogResponse, error) {
+	var driveResp DriveLogResponse
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointDrivelog,
+		method:        http.MethodGet,
+		path:          fmt.Sprintf(deviceDriveAPIPath, deviceUUID),
+		authenticated: true,
+		attrs:         []interface{}{"device_uuid", deviceUUID},
+	}, &driveResp)
 	if err != nil {
 		return nil, err
 	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
-	var deviceResp DevicePropertiesResponse
-	err = json.Unmarshal(respData, &deviceResp)
-	if err != nil {
-		return nil, err
-	}
-	return &deviceResp, nil
+	return &driveResp, nil
 }
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DriftUnknownField = "unknown_field" // a field in the response with no matching struct field
+	DriftTypeMismatch = "type_mismatch" // a field whose json type does not decode into the struct field
+	DriftInvalidValue = "invalid_value" // a field whose value is ignored when decoding, e.g. an unparsable date
+)
+
+// DriftIssue is a single difference between a response and the expected schema.
+type DriftIssue struct {
+	Endpoint string // the endpoint name
+	Path     string // dotted field path, [] marks array elements: [].device_log.newField
+	Kind     string // DriftUnknownField or DriftTypeMismatch
+	Detail   string // the expected and actual types for a mismatch, empty otherwise
+}
+
+// DriftEntry aggregates occurrences of a DriftIssue.
+type DriftEntry struct {
+	DriftIssue
+	Count     int64     // responses the issue was seen in
+	FirstSeen time.Time // first time the issue was seen
+	LastSeen  time.Time // last time the issue was seen
+}
+
+// DriftReport collects the schema drift detected in strict decoding mode.
+type DriftReport struct {
+	entries map[DriftIssue]*DriftEntry
+	mu      sync.Mutex
+}
+
+// NewDriftReport returns an empty drift report.
+func NewDriftReport() *DriftReport {
+	return &DriftReport{
+		entries: make(map[DriftIssue]*DriftEntry),
+	}
+}
+
+func (r *DriftReport) record(issue DriftIssue) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.entries[issue]
+	if !ok {
+		e = &DriftEntry{DriftIssue: issue, FirstSeen: now}
+		r.entries[issue] = e
+	}
+	e.Count++
+	e.LastSeen = now
+}
+
+// Entries returns the drift seen so far sorted by endpoint, path and kind.
+func (r *DriftReport) Entries() []DriftEntry {
+	r.mu.Lock()
+	out := make([]DriftEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, *e)
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Endpoint != out[j].Endpoint {
+			return out[i].Endpoint < out[j].Endpoint
+		}
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
+
+// Reset clears the report.
+func (r *DriftReport) Reset() {
+	r.mu.Lock()
+	r.entries = make(map[DriftIssue]*DriftEntry)
+	r.mu.Unlock()
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	jsonNumberType      = reflect.TypeOf(json.Number(""))
+)
+
+// detectDrift compares the json in data against the type of out and returns each issue once.
+func detectDrift(endpoint string, data []byte, out interface{}) ([]DriftIssue, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	seen := make(map[DriftIssue]bool)
+	var issues []DriftIssue
+	walkDrift("", v, reflect.TypeOf(out), func(path, kind, detail string) {
+		issue := DriftIssue{Endpoint: endpoint, Path: path, Kind: kind, Detail: detail}
+		if !seen[issue] {
+			seen[issue] = true
+			issues = append(issues, issue)
+		}
+	})
+	return issues, nil
+}
+
+func walkDrift(path string, v interface{}, t reflect.Type, report func(path, kind, detail string)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v == nil {
+		return
+	}
+	mismatch := func(expected string) {
+		report(path, DriftTypeMismatch, fmt.Sprintf("expected %s, got %s", expected, jsonTypeName(v)))
+	}
+	if t == jsonNumberType {
+		if _, ok := v.(json.Number); !ok {
+			if _, ok := v.(string); !ok {
+				mismatch("number or string")
+			}
+		}
+		return
+	}
+	customDecoder := reflect.PointerTo(t).Implements(jsonUnmarshalerType)
+	if customDecoder && t.Kind() != reflect.Struct {
+		return
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		s, ok := v.(string)
+		if !ok {
+			mismatch("string")
+		} else if _, err := parseDeviceLogDate(s); err != nil {
+			report(path, DriftInvalidValue, fmt.Sprintf("unparsable date %q", s))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			mismatch("string")
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			mismatch("bool")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := v.(json.Number)
+		if !ok {
+			mismatch("integer")
+		} else if _, err := n.Int64(); err != nil {
+			mismatch("integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			mismatch("number")
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]interface{})
+		if !ok {
+			mismatch("array")
+			return
+		}
+		for _, item := range items {
+			walkDrift(path+"[]", item, t.Elem(), report)
+		}
+	case reflect.Map:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		for k, item := range m {
+			walkDrift(joinPath(path, k), item, t.Elem(), report)
+		}
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		fields := jsonFields(t)
+		for k, item := range m {
+			field, ok := fields[k]
+			if !ok {
+				// encoding/json falls back to a case-insensitive match
+				for name, f := range fields {
+					if strings.EqualFold(name, k) {
+						field, ok = f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				report(joinPath(path, k), DriftUnknownField, "")
+				continue
+			}
+			fieldPath := joinPath(path, k)
+			if !customDecoder {
+				walkDrift(fieldPath, item, field.Type, report)
+				continue
+			}
+			// custom decoders such as DeviceLog accept other encodings for some fields,
+			// so only report a mismatch on this field if it really fails to decode
+			walkDrift(fieldPath, item, field.Type, func(p, kind, detail string) {
+				if p == fieldPath && kind == DriftTypeMismatch && decodesField(t, k, item) {
+					return
+				}
+				report(p, kind, detail)
+			})
+		}
+	}
+}
+
+// decodesField returns true if {key: value} decodes into a new t.
+func decodesField(t reflect.Type, key string, value interface{}) bool {
+	data, err := json.Marshal(map[string]interface{}{key: value})
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, reflect.New(t).Interface()) == nil
+}
+
+// jsonFields maps the json names of t's exported fields to the fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func driftStrings(issues []DriftIssue) string {
+	var out []string
+	for _, issue := range issues {
+		s := issue.Kind + " " + issue.Path
+		if issue.Detail != "" {
+			s += " (" + issue.Detail + ")"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, "; ")
+}
+
+func TestDetectDriftUnknownFields(t *testing.T) {
+	data := `[
+		{"UUID": "a", "title": "Smoker", "newField": 1, "channels": [{"channel": 1, "extra": true}]},
+		{"uuid": "b", "newField": 2, "device_log": {"newLogField": "x"}}
+	]`
+	issues, err := detectDrift("devices", []byte(data), &ListDevicesResponse{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each issue is reported once, a field matching case-insensitively is not unknown
+	got := map[string]bool{}
+	for _, issue := range issues {
+		if issue.Endpoint != "devices" {
+			t.Errorf("endpoint: got %q", issue.Endpoint)
+		}
+		got[issue.Kind+" "+issue.Path] = true
+	}
+	want := []string{
+		"unknown_field [].newField",
+		"unknown_field [].channels[].extra",
+		"unknown_field [].device_log.newLogField",
+	}
+	if len(issues) != len(want) {
+		t.Errorf("got %s, want %v", driftStrings(issues), want)
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("missing %q in %s", w, driftStrings(issues))
+		}
+	}
+}
+
+func TestDetectDriftTypeMismatches(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"string for int", `{"id": "12"}`, "type_mismatch id (expected integer, got string)"},
+		{"float for int", `{"id": 1.5}`, "type_mismatch id (expected integer, got number)"},
+		{"number for string", `{"title": 7}`, "type_mismatch title (expected string, got number)"},
+		{"string for bool", `{"active": "yes"}`, "type_mismatch active (expected bool, got string)"},
+		{"number for time", `{"created": 1662000000}`, "type_mismatch created (expected string, got number)"},
+		{"object for array", `{"channels": {}}`, "type_mismatch channels (expected array, got object)"},
+		{"array for object", `{"device_log": []}`, "type_mismatch device_log (expected object, got array)"},
+		{"nested", `{"channels": [{"channel": "1"}]}`, "type_mismatch channels[].channel (expected integer, got string)"},
+		{"unparsable device log date", `{"device_log": {"date": "yesterday"}}`, `invalid_value device_log.date (unparsable date "yesterday")`},
+		{"device log dates", `{"device_log": {"date": "2022-09-01 00:36:11 UTC"}, "last_templog": "2022-09-01T00:36:11Z"}`, ""},
+		{"null is not drift", `{"title": null, "channels": null}`, ""},
+		{"matching types", `{"id": 1, "title": "a", "active": true, "created": "2022-09-01T00:00:00Z"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := detectDrift("device", []byte(tt.data), &DevicePropertiesResponse{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := driftStrings(issues); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := detectDrift("device", []byte(`{`), &DevicePropertiesResponse{}); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
+
+func TestDeviceLogIgnoresUnparsableDate(t *testing.T) {
+	var devices ListDevicesResponse
+	data := `[{"uuid": "a", "device_log": {"date": "yesterday", "model": "FBX2"}}, {"uuid": "b", "device_log": {"date": "2022-09-01 00:36:11 UTC"}}]`
+	if err := json.Unmarshal([]byte(data), &devices); err != nil {
+		t.Fatalf("an unparsable date failed the response: %v", err)
+	}
+	if len(devices) != 2 || !devices[0].DeviceLog.Date.IsZero() || devices[0].DeviceLog.Model != "FBX2" {
+		t.Errorf("got %+v, want the log decoded with a zero date", devices)
+	}
+	if want := time.Date(2022, 9, 1, 0, 36, 11, 0, time.UTC); !devices[1].DeviceLog.Date.Equal(want) {
+		t.Errorf("got date %v, want %v", devices[1].DeviceLog.Date, want)
+	}
+}
+
+func TestStrictDecodingRecordsDrift(t *testing.T) {
+	body := `[{"UUID": "a", "channel_count": "6", "newField": 1}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client := NewDefaultAPIClient()
+	client.SetBaseURL(server.URL)
+	client.SetLogger(nil)
+	if err := client.authStore.StoreToken("token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stat := &recordingStat{}
+	client.SetStatsd(stat, []string{"env:test"})
+
+	// without strict mode a mismatch fails the request and nothing is recorded
+	if _, err := client.ListDevices(context.Background()); err == nil {
+		t.Error("expected the type mismatch to fail the request")
+	}
+	if entries := client.GetDriftReport().Entries(); len(entries) != 0 {
+		t.Errorf("got drift %+v outside strict mode", entries)
+	}
+
+	client.SetStrictDecoding(true)
+	for i := 0; i < 2; i++ {
+		devices, err := client.ListDevices(context.Background())
+		if err != nil {
+			t.Fatalf("strict mode: %v", err)
+		}
+		if len(devices) != 1 || devices[0].UUID != "a" {
+			t.Errorf("got %+v, want the rest of the response decoded", devices)
+		}
+	}
+	entries := client.GetDriftReport().Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %+v, want two issues", entries)
+	}
+	if e := entries[0]; e.Path != "[].channel_count" || e.Kind != DriftTypeMismatch || e.Count != 2 || e.FirstSeen.After(e.LastSeen) {
+		t.Errorf("got %+v", e)
+	}
+	if e := entries[1]; e.Path != "[].newField" || e.Kind != DriftUnknownField || e.Count != 2 {
+		t.Errorf("got %+v", e)
+	}
+
+	drift := stat.named("fireboard.api.schema_drift")
+	if len(drift) != 4 {
+		t.Fatalf("got %v, want one count per issue and response", drift)
+	}
+	for _, m := range drift {
+		if tags := strings.Join(m.tags, ","); !strings.HasPrefix(tags, "env:test,endpoint:devices,kind:") || strings.Contains(tags, "field:") {
+			t.Errorf("got tags %s, want only the endpoint and kind", tags)
+		}
+	}
+
+	client.GetDriftReport().Reset()
+	if entries := client.GetDriftReport().Entries(); len(entries) != 0 {
+		t.Errorf("got %+v after reset", entries)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// fixtureTypes maps each fixture file name to the type it is decoded into.
+var fixtureTypes = map[string]func() interface{}{
+	"device.json":     func() interface{} { return new(DevicePropertiesResponse) },
+	"device_log.json": func() interface{} { return new(DeviceLog) },
+	"drivelog.json":   func() interface{} { return new(DriveLogResponse) },
+	"temps.json":      func() interface{} { return new(RealTimeTemperatureResponse) },
+	"chart.json":      func() interface{} { return new(SessionChartResponse) },
+}
+
+// derivedValues returns the parsed values of the string encoded fields so they are covered by the golden files.
+func derivedValues(v interface{}) map[string]interface{} {
+	deviceLog := func(l DeviceLog) map[string]interface{} {
+		return map[string]interface{}{
+			"cpu_percent":          l.CPUPercent(),
+			"disk_usage_percent":   l.DiskUsagePercent(),
+			"memory_usage_percent": l.MemoryUsagePercent(),
+			"link_quality_percent": l.LinkQualityPercent(),
+			"uptime_seconds":       l.UptimeSeconds(),
+		}
+	}
+	switch o := v.(type) {
+	case *DeviceLog:
+		return deviceLog(*o)
+	case *DevicePropertiesResponse:
+		return deviceLog(o.DeviceLog)
+	case *SessionChartResponse:
+		types := make([]string, 0, len(*o))
+		for _, c := range *o {
+			types = append(types, c.ChannelType())
+		}
+		return map[string]interface{}{"channel_types": types}
+	}
+	return nil
+}
+
+func TestGoldenFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "fixtures", "*", "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		rel, _ := filepath.Rel(filepath.Join("testdata", "fixtures"), fixture)
+		t.Run(rel, func(t *testing.T) {
+			newValue, ok := fixtureTypes[filepath.Base(fixture)]
+			if !ok {
+				t.Fatalf("unknown fixture type %s", filepath.Base(fixture))
+			}
+			data, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := newValue()
+			if err := json.Unmarshal(data, out); err != nil {
+				t.Fatalf("decode failed: %v", err)
+			}
+			issues, err := detectDrift("fixture", data, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, issue := range issues {
+				t.Errorf("schema drift: %s %s %s", issue.Kind, issue.Path, issue.Detail)
+			}
+
+			got, err := json.MarshalIndent(map[string]interface{}{
+				"decoded": out,
+				"derived": derivedValues(out),
+			}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", "golden", rel)
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run go test ./pkg/api -run TestGoldenFixtures -update: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("decoded %s does not match %s\ngot:\n%s", fixture, golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func FuzzDeviceLogParsers(f *testing.F) {
+	f.Add("66%", "0.8M/4.0M", "2.7M/4.2M", "62/100", "3:42", "2022-09-01 00:36:11 UTC")
+	f.Add("7.5%", "1.1M/4.0M", "3.9M/4.2M", "41/70", "121:07", "2020-11-02T19:04:55Z")
+	f.Add("", "", "", "", "", "")
+	f.Add("%", "0M/0M", "M/", "1/0", ":", "UTC")
+	f.Add("NaN%", "1.2.3M/4M", "9/", "/", "-1:99", "2022-13-45 99:99:99 XYZ")
+
+	f.Fuzz(func(t *testing.T, cpu, disk, mem, link, uptime, date string) {
+		l := DeviceLog{
+			CPUUsage:    cpu,
+			DiskUsage:   disk,
+			MemoryUsage: mem,
+			LinkQuality: link,
+			Uptime:      uptime,
+		}
+		for name, v := range map[string]float64{
+			"cpu":    l.CPUPercent(),
+			"disk":   l.DiskUsagePercent(),
+			"mem":    l.MemoryUsagePercent(),
+			"link":   l.LinkQualityPercent(),
+			"uptime": l.UptimeSeconds(),
+		} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("%s parsed to %v", name, v)
+			}
+		}
+		_, _ = parseDeviceLogDate(date)
+	})
+}
+
+func FuzzSessionChartChannelType(f *testing.F) {
+	f.Add([]byte(`{"channel_id": 1}`))
+	f.Add([]byte(`{"channel_id": "drive_00000000-0000-4000-8000-000000000001"}`))
+	f.Add([]byte(`{"channel_id": ""}`))
+	f.Add([]byte(`{"channel_id": null}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s SessionChartObject
+		if err := json.Unmarshal(data, &s); err != nil {
+			return
+		}
+		_ = s.ChannelType()
+		if _, err := json.Marshal(s); err != nil {
+			t.Errorf("unable to re-encode %q: %v", data, err)
+		}
+	})
+}
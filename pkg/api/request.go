@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+
+// endpoint names used to identify api calls in logs
+const (
+	endpointAuth     = "auth"
+	endpointDevices  = "devices"
+	endpointTemps    = "temps"
+	endpointDrivelog = "drivelog"
+	endpointSessions = "sessions"
+	endpointChart    = "chart"
+)
+
+type apiRequest struct {
+	endpoint      string        // endpoint name, one of the endpoint* constants
+	method        string        // http method
+	path          string        // api path, may include a query string
+	body          interface{}   // optional body, marshalled to json
+	authenticated bool          // set the auth token headers
+	attrs         []interface{} // extra logging attributes such as device_uuid or session_id
+}
+
+// spanAttributes converts the logging attributes to span attributes.
+func (r apiRequest) spanAttributes() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("fireboard.endpoint", r.endpoint),
+	}
+	for i := 0; i+1 < len(r.attrs); i += 2 {
+		key := fmt.Sprintf("fireboard.%v", r.attrs[i])
+		switch v := r.attrs[i+1].(type) {
+		case string:
+			attrs = append(attrs, attribute.String(key, v))
+		case int64:
+			attrs = append(attrs, attribute.Int64(key, v))
+		default:
+			attrs = append(attrs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return attrs
+}
+
+// do executes the request and decodes a 200 response into out.
+// Each call is traced as an http client span using the global tracer provider. Get requests failing with a transport
+// error or a server error are retried with exponential backoff, each attempt taking from the request budget.
+func (a *defaultApiClient) do(ctx context.Context, r apiRequest, out interface{}) (err error) {
+	logger := a.getLogger().With("endpoint", r.endpoint).With(r.attrs...)
+	urlPath := a.constructURL(r.path)
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "fireboard.api."+r.endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(r.spanAttributes()...),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.method),
+			semconv.URLFull(urlPath),
+		),
+	)
+	retries := 0
+	defer func() {
+		if retries > 0 {
+			span.SetAttributes(semconv.HTTPRequestResendCount(retries))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetAttributes(semconv.ErrorTypeKey.String(errorType(err)))
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	maxRetries, backoff := a.getRetries()
+	var respData []byte
+	for {
+		var status int
+		var retryable bool
+		status, respData, retryable, err = a.send(ctx, r, urlPath, logger)
+		if status != 0 {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		}
+		if err == nil || !retryable || r.method != http.MethodGet || retries >= maxRetries {
+			break
+		}
+		wait := backoff << retries
+		retries++
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("fireboard.retry.attempt", retries),
+			attribute.String("fireboard.retry.reason", err.Error()),
+			attribute.String("fireboard.retry.backoff", wait.String()),
+		))
+		logger.Warn("fireboard api request retrying", "error", err, "attempt", retries, "backoff", wait)
+		a.recordRetry(r.endpoint)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(respData, out)
+	if a.isStrictDecoding() {
+		a.recordDrift(r.endpoint, respData, out, logger)
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			// mismatches are reported as drift, the rest of the response was still decoded
+			err = nil
+		}
+	}
+	if err != nil {
+		logger.Error("fireboard api response decode failed", "error", err)
+		return err
+	}
+	return nil
+}
+
+// send makes a single attempt at the request and returns the response status and body of a 200 response, a status of
+// 0 if no response was received. retryable is true for transport and server errors, a request the circuit breaker or
+// the request budget did not allow is not retried.
+func (a *defaultApiClient) send(ctx context.Context, r apiRequest, urlPath string, logger *slog.Logger) (status int, respData []byte, retryable bool, err error) {
+	breaker := a.getBreaker(r.endpoint)
+	previous := breaker.State()
+	allowErr := breaker.allow()
+	a.recordBreakerState(breaker, previous, breaker.State(), logger)
+	if err := allowErr; err != nil {
+		logger.Warn("fireboard api request not sent", "error", err)
+		return 0, nil, false, err
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			breaker.release()
+		}
+	}()
+
+	var body io.Reader
+	if r.body != nil {
+		data, err := json.Marshal(r.body)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		body = bytes.NewBuffer(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.GetTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(
+		ctx,
+		r.method,
+		urlPath,
+		body,
+	)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if r.authenticated {
+		err = SetRequestHeaders(req, a.authStore)
+		if err != nil {
+			logger.Warn("fireboard api request not sent", "error", err)
+			return 0, nil, false, err
+		}
+	} else {
+		req.Header.Add("Content-Type", contentType)
+		req.Header.Add("Accept", contentType)
+	}
+
+	if !a.budget.Take() {
+		logger.Warn("fireboard api request not sent", "error", ErrBudgetExhausted)
+		return 0, nil, false, ErrBudgetExhausted
+	}
+	sent = true
+	start := time.Now()
+	resp, err := a.getHttpClient().Do(req)
+	if err != nil {
+		a.recordBreakerResult(breaker, false, logger)
+		a.recordRequestMetrics(r.endpoint, 0, time.Since(start))
+		logger.Error("fireboard api request failed", "error", err, "latency", time.Since(start))
+		return 0, nil, true, err
+	}
+	defer resp.Body.Close()
+	respData, err = io.ReadAll(resp.Body)
+	if err != nil {
+		a.recordBreakerResult(breaker, false, logger)
+		logger.Error("fireboard api response read failed", "error", err, "status", resp.StatusCode)
+		return resp.StatusCode, nil, true, err
+	}
+	// rate limits and server errors count against the breaker, other responses show the api is reachable
+	a.recordBreakerResult(breaker, resp.StatusCode != 429 && resp.StatusCode < 500, logger)
+	a.recordRequestMetrics(r.endpoint, resp.StatusCode, time.Since(start))
+	logger = logger.With("status", resp.StatusCode, "latency", time.Since(start))
+	if resp.StatusCode == 429 {
+		// back off though this is not documented.
+		logger.Warn("fireboard api rate limited")
+		return resp.StatusCode, nil, false, ErrRateLimited
+	} else if resp.StatusCode != 200 {
+		logger.Error("fireboard api unexpected status")
+		return resp.StatusCode, nil, resp.StatusCode >= 500, &StatusError{Endpoint: r.endpoint, StatusCode: resp.StatusCode, Body: string(respData)}
+	}
+	logger.Debug("fireboard api request complete")
+	return resp.StatusCode, respData, false, nil
+}
+
+// StatusError is returned when the API responds with an unexpected status.
+type StatusError struct {
+	Endpoint   string // the endpoint name: devices, temps, drivelog, sessions, chart or auth
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s endpoint: %v", e.StatusCode, e.Endpoint, e.Body)
+}
+
+// errorType returns the error.type span attribute value of err.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, ErrBudgetExhausted):
+		return "budget_exhausted"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+func (a *defaultApiClient) getLogger() *slog.Logger {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.logger
+}
+
+// recordRequestMetrics emits the api self-metrics when a statsd client is configured, a status of 0 is a transport error.
+func (a *defaultApiClient) recordRequestMetrics(endpoint string, status int, latency time.Duration) {
+	stat, tags := a.getStatsd()
+	if stat == nil {
+		return
+	}
+	statusTag := "status_code:error"
+	if status != 0 {
+		statusTag = fmt.Sprintf("status_code:%d", status)
+	}
+	endpointTags := append(append(make([]string, 0, len(tags)+2), tags...), "endpoint:"+endpoint)
+	stat.Distribution("fireboard.api.request.duration", latency.Seconds(), append(endpointTags, statusTag), 1)
+	stat.Incr("fireboard.api.requests", append(endpointTags, statusTag), 1)
+	if status == 429 {
+		stat.Incr("fireboard.api.rate_limited", endpointTags, 1)
+	}
+	stat.Gauge("fireboard.api.budget.remaining", float64(a.budget.Remaining()), tags, 1)
+}
+
+// recordRetry emits fireboard.api.retries when a statsd client is configured.
+func (a *defaultApiClient) recordRetry(endpoint string) {
+	stat, tags := a.getStatsd()
+	if stat == nil {
+		return
+	}
+	stat.Incr("fireboard.api.retries", append(append(make([]string, 0, len(tags)+1), tags...), "endpoint:"+endpoint), 1)
+}
+
+// getBreaker returns the circuit breaker for endpoint, creating it on first use.
+func (a *defaultApiClient) getBreaker(endpoint string) *circuitBreaker {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b, ok := a.breakers[endpoint]
+	if !ok {
+		b = newCircuitBreaker(endpoint, a.breakerThreshold, a.breakerCooldown)
+		a.breakers[endpoint] = b
+	}
+	return b
+}
+
+// recordBreakerResult records the request outcome, logging transitions and emitting the breaker state metric.
+func (a *defaultApiClient) recordBreakerResult(b *circuitBreaker, success bool, logger *slog.Logger) {
+	previous := b.State()
+	a.recordBreakerState(b, previous, b.record(success), logger)
+}
+
+// recordBreakerState logs a breaker transition and emits the breaker state metric. It is called whether a request
+// is allowed or rejected, so the metric keeps reporting a breaker that stays open.
+func (a *defaultApiClient) recordBreakerState(b *circuitBreaker, previous, state BreakerState, logger *slog.Logger) {
+	if state != previous {
+		logger.Warn("fireboard api circuit breaker state changed", "from", previous.String(), "to", state.String())
+	}
+	stat, tags := a.getStatsd()
+	if stat == nil {
+		return
+	}
+	stat.Gauge("fireboard.api.circuit_breaker.state", float64(state), append(append(make([]string, 0, len(tags)+1), tags...), "endpoint:"+b.endpoint), 1)
+}
+
+// recordDrift adds the schema drift in a response to the drift report and emits fireboard.api.schema_drift.
+// Field paths are only logged and kept in the report, as a tag they would create a metric context per field.
+func (a *defaultApiClient) recordDrift(endpoint string, data []byte, out interface{}, logger *slog.Logger) {
+	issues, err := detectDrift(endpoint, data, out)
+	if err != nil {
+		logger.Warn("fireboard api drift detection failed", "error", err)
+		return
+	}
+	stat, tags := a.getStatsd()
+	for _, issue := range issues {
+		a.drift.record(issue)
+		logger.Warn("fireboard api schema drift", "path", issue.Path, "kind", issue.Kind, "detail", issue.Detail)
+		if stat != nil {
+			driftTags := append(append(make([]string, 0, len(tags)+2), tags...),
+				"endpoint:"+endpoint, "kind:"+issue.Kind)
+			stat.Incr("fireboard.api.schema_drift", driftTags, 1)
+		}
+	}
+}
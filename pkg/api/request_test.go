@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metric is a single emission captured by recordingStat.
+type metric struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+// recordingStat captures the gauges, increments and distributions emitted by the client.
+type recordingStat struct {
+	statsd.NoOpClient
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func (r *recordingStat) add(name string, value float64, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, metric{name: name, value: value, tags: tags})
+	return nil
+}
+
+func (r *recordingStat) Gauge(name string, value float64, tags []string, _ float64) error {
+	return r.add(name, value, tags)
+}
+
+func (r *recordingStat) Incr(name string, tags []string, _ float64) error {
+	return r.add(name, 1, tags)
+}
+
+func (r *recordingStat) Distribution(name string, value float64, tags []string, _ float64) error {
+	return r.add(name, value, tags)
+}
+
+func (r *recordingStat) named(name string) []metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []metric
+	for _, m := range r.metrics {
+		if m.name == name {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// recordSpans installs a global tracer provider recording every span until the test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// newTestClient returns an authenticated client for the server answering with the statuses in turn, the last one
+// repeating, and the number of requests the server received.
+func newTestClient(t *testing.T, statuses ...int) (*defaultApiClient, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		status := statuses[len(statuses)-1]
+		if n <= len(statuses) {
+			status = statuses[n-1]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewDefaultAPIClient()
+	client.SetBaseURL(server.URL)
+	client.SetLogger(nil)
+	client.SetRetries(2, time.Millisecond)
+	if err := client.authStore.StoreToken("token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return client, &requests
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestDoRecordsClientSpan(t *testing.T) {
+	recorder := recordSpans(t)
+	client, _ := newTestClient(t, http.StatusOK)
+	if _, err := client.GetRealTimeDeviceTemperature(context.Background(), "device-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "fireboard.api.temps" || span.SpanKind() != trace.SpanKindClient || span.Status().Code == codes.Error {
+		t.Errorf("got span %s of kind %s with status %v", span.Name(), span.SpanKind(), span.Status())
+	}
+	attrs := spanAttributes(span)
+	if got := attrs["http.request.method"].AsString(); got != http.MethodGet {
+		t.Errorf("method: got %q", got)
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("status code: got %d", got)
+	}
+	if got := attrs["fireboard.endpoint"].AsString(); got != "temps" {
+		t.Errorf("endpoint: got %q", got)
+	}
+	if got := attrs["fireboard.device_uuid"].AsString(); got != "device-a" {
+		t.Errorf("device uuid: got %q", got)
+	}
+	if _, ok := attrs["url.full"]; !ok {
+		t.Error("missing url.full")
+	}
+	if _, ok := attrs["http.request.resend_count"]; ok {
+		t.Error("resend count set without a retry")
+	}
+}
+
+func TestDoRetriesServerErrors(t *testing.T) {
+	recorder := recordSpans(t)
+	client, requests := newTestClient(t, http.StatusServiceUnavailable, http.StatusOK)
+	if _, err := client.ListDevices(context.Background()); err != nil {
+		t.Fatalf("the retry failed: %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if got := client.GetRequestBudget().Total(); got != 2 {
+		t.Errorf("the retry took %d from the budget, want 2", got)
+	}
+
+	span := recorder.Ended()[0]
+	attrs := spanAttributes(span)
+	if got := attrs["http.request.resend_count"].AsInt64(); got != 1 {
+		t.Errorf("resend count: got %d, want 1", got)
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusOK {
+		t.Errorf("status code: got %d, want the final response", got)
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != "retry" {
+		t.Errorf("got events %+v, want one retry", events)
+	}
+	if span.Status().Code == codes.Error {
+		t.Errorf("got status %v after a successful retry", span.Status())
+	}
+}
+
+func TestDoGivesUpAfterMaxRetries(t *testing.T) {
+	recorder := recordSpans(t)
+	client, requests := newTestClient(t, http.StatusInternalServerError)
+	if _, err := client.ListDevices(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want the first and 2 retries", got)
+	}
+	span := recorder.Ended()[0]
+	attrs := spanAttributes(span)
+	if got := attrs["http.request.resend_count"].AsInt64(); got != 2 {
+		t.Errorf("resend count: got %d, want 2", got)
+	}
+	if _, ok := attrs["error.type"]; !ok || span.Status().Code != codes.Error {
+		t.Errorf("got status %v and attributes %v, want an error", span.Status(), attrs)
+	}
+}
+
+func TestDoDoesNotRetry(t *testing.T) {
+	for name, tt := range map[string]struct {
+		status int
+		call   func(*defaultApiClient) error
+	}{
+		"rate limited": {http.StatusTooManyRequests, func(c *defaultApiClient) error { _, err := c.ListDevices(context.Background()); return err }},
+		"client error": {http.StatusNotFound, func(c *defaultApiClient) error { _, err := c.ListDevices(context.Background()); return err }},
+		"post":         {http.StatusBadGateway, func(c *defaultApiClient) error { _, err := c.GetAuthToken(context.Background(), "u", "p"); return err }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, requests := newTestClient(t, tt.status)
+			if err := tt.call(client); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := requests.Load(); got != 1 {
+				t.Errorf("got %d requests, want no retry", got)
+			}
+		})
+	}
+
+	client, requests := newTestClient(t, http.StatusServiceUnavailable)
+	client.SetRetries(0, time.Millisecond)
+	if _, err := client.ListDevices(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("retries disabled: got %d requests", got)
+	}
+}
+
+func TestDoRecordsRequestMetrics(t *testing.T) {
+	client, _ := newTestClient(t, 500, 429)
+	stat := &recordingStat{}
+	client.SetStatsd(stat, []string{"env:test"})
+	if _, err := client.ListDevices(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var statuses []string
+	for _, m := range stat.named("fireboard.api.requests") {
+		statuses = append(statuses, strings.Join(m.tags, ","))
+	}
+	want := []string{"env:test,endpoint:devices,status_code:500", "env:test,endpoint:devices,status_code:429"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got requests %v, want %v", statuses, want)
+	}
+	if got := stat.named("fireboard.api.request.duration"); len(got) != 2 {
+		t.Errorf("got %d durations, want one per attempt", len(got))
+	}
+	if got := stat.named("fireboard.api.retries"); len(got) != 1 || strings.Join(got[0].tags, ",") != "env:test,endpoint:devices" {
+		t.Errorf("got retries %v, want one tagged with the endpoint", got)
+	}
+	if got := stat.named("fireboard.api.rate_limited"); len(got) != 1 {
+		t.Errorf("got %d rate limited counts, want 1", len(got))
+	}
+	remaining := stat.named("fireboard.api.budget.remaining")
+	if len(remaining) != 2 || remaining[1].value != float64(DefaultHourlyRequestLimit-2) {
+		t.Errorf("got budget remaining %v, want %d after two requests", remaining, DefaultHourlyRequestLimit-2)
+	}
+}
+
+func TestDoRecordsTransportErrorStatus(t *testing.T) {
+	client, _ := newTestClient(t, 200)
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client.SetBaseURL(server.URL)
+	client.SetRetries(0, time.Millisecond)
+	stat := &recordingStat{}
+	client.SetStatsd(stat, nil)
+	if _, err := client.ListDevices(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	got := stat.named("fireboard.api.requests")
+	if len(got) != 1 || strings.Join(got[0].tags, ",") != "endpoint:devices,status_code:error" {
+		t.Errorf("got requests %v, want one tagged status_code:error", got)
+	}
+}
+
+func TestDoRecordsBreakerStateWhileOpen(t *testing.T) {
+	client, _ := newTestClient(t, 500)
+	client.SetRetries(0, time.Millisecond)
+	client.SetCircuitBreaker(1, time.Minute)
+	stat := &recordingStat{}
+	client.SetStatsd(stat, nil)
+	// the first request fails and opens the breaker, the second is rejected
+	client.ListDevices(context.Background())
+	if _, err := client.ListDevices(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	breaker := client.getBreaker(endpointDevices)
+	breaker.now = func() time.Time { return time.Now().Add(time.Minute) }
+	client.ListDevices(context.Background()) // the probe fails
+
+	var states []float64
+	for _, m := range stat.named("fireboard.api.circuit_breaker.state") {
+		states = append(states, m.value)
+	}
+	want := []float64{float64(BreakerClosed), float64(BreakerOpen), float64(BreakerOpen), float64(BreakerHalfOpen), float64(BreakerOpen)}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("got breaker states %v, want %v", states, want)
+	}
+}
+
+func TestDoLogsToInjectedLogger(t *testing.T) {
+	client, _ := newTestClient(t, 200)
+	var out bytes.Buffer
+	client.SetLogger(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	if _, err := client.GetRealTimeDeviceTemperature(context.Background(), "device-a"); err != nil {
+		t.Fatal(err)
+	}
+	logged := out.String()
+	for _, want := range []string{"fireboard api request complete", "device_uuid=device-a", "status=200", "latency="} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("logs are missing %q: %s", want, logged)
+		}
+	}
+	// the debug round tripper is off unless enabled
+	if strings.Contains(logged, "fireboard api response") {
+		t.Errorf("debug request logs were written without debug logging enabled: %s", logged)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -31,42 +30,14 @@ type SessionListResponse struct {
 
 type SessionsListResponse []SessionListResponse
 
-func (a *defaultApiClient) ListAllSessions() (SessionsListResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(sessionsListAPIPath)
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
+func (a *defaultApiClient) ListAllSessions(ctx context.Context) (SessionsListResponse, error) {
 	var sResp SessionsListResponse
-	err = json.Unmarshal(respData, &sResp)
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointSessions,
+		method:        http.MethodGet,
+		path:          sessionsListAPIPath,
+		authenticated: true,
+	}, &sResp)
 	if err != nil {
 		return nil, err
 	}
@@ -117,42 +88,15 @@ type SessionGetResponse struct {
 	Owner OwnerResponse `json:"owner,omitempty"` // owner information
 }
 
-func (a *defaultApiClient) GetSession(sessionID int64) (*SessionGetResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(fmt.Sprintf(sessionsGetAPIPath, sessionID))
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
+func (a *defaultApiClient) GetSession(ctx context.Context, sessionID int64) (*SessionGetResponse, error) {
 	var sResp SessionGetResponse
-	err = json.Unmarshal(respData, &sResp)
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointSessions,
+		method:        http.MethodGet,
+		path:          fmt.Sprintf(sessionsGetAPIPath, sessionID),
+		authenticated: true,
+		attrs:         []interface{}{"session_id", sessionID},
+	}, &sResp)
 	if err != nil {
 		return nil, err
 	}
@@ -168,6 +112,56 @@ type SessionChartObject struct {
 	Y          []float32   `json:"y,omitempty"`          // the values in degreeType if a temperature
 }
 
+// UnmarshalJSON decodes the chart object, channel_id may be an integer or a "${type}_${uuid}" string.
+func (s *SessionChartObject) UnmarshalJSON(data []byte) error {
+	type chartObject SessionChartObject
+	var raw struct {
+		chartObject
+		ChannelID json.RawMessage `json:"channel_id,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = SessionChartObject(raw.chartObject)
+	if len(raw.ChannelID) > 0 && raw.ChannelID[0] == '"' {
+		var id string
+		if err := json.Unmarshal(raw.ChannelID, &id); err != nil {
+			return err
+		}
+		s.ChannelID = json.Number(id)
+	} else if len(raw.ChannelID) > 0 && string(raw.ChannelID) != "null" {
+		s.ChannelID = json.Number(raw.ChannelID)
+	}
+	return nil
+}
+
+// MarshalJSON encodes the chart object, writing non integer channel ids as strings.
+func (s SessionChartObject) MarshalJSON() ([]byte, error) {
+	type chartObject SessionChartObject
+	var channelID interface{} = s.ChannelID
+	if s.ChannelID == "" {
+		channelID = nil
+	} else if !isJSONNumber(s.ChannelID.String()) {
+		channelID = s.ChannelID.String()
+	}
+	return json.Marshal(struct {
+		chartObject
+		ChannelID interface{} `json:"channel_id,omitempty"`
+	}{
+		chartObject: chartObject(s),
+		ChannelID:   channelID,
+	})
+}
+
+// isJSONNumber returns true if s is a valid json number literal.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	var n json.Number
+	return json.Unmarshal([]byte(s), &n) == nil
+}
+
 // return the channel type
 func (s SessionChartObject) ChannelType() string {
 	if _, err := s.ChannelID.Int64(); err == nil {
@@ -179,42 +173,15 @@ func (s SessionChartObject) ChannelType() string {
 
 type SessionChartResponse []SessionChartObject
 
-func (a *defaultApiClient) GetSessionChartData(sessionID int64) (SessionChartResponse, error) {
-	c := a.getHttpClient()
-	urlPath := a.constructURL(fmt.Sprintf(sessionChartDataAPIPath, sessionID))
-	ctx, cancel := context.WithTimeout(context.Background(), a.GetTimeout())
-	defer cancel()
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		urlPath,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
-	err = SetRequestHeaders(req, a.authStore)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode == 429 {
-		// back off though this is not documented.
-		return nil, ErrRateLimited
-	} else if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("unable to obtain auth token: %v", string(respData))
-	}
-
+func (a *defaultApiClient) GetSessionChartData(ctx context.Context, sessionID int64) (SessionChartResponse, error) {
 	var sResp SessionChartResponse
-	err = json.Unmarshal(respData, &sResp)
+	err := a.do(ctx, apiRequest{
+		endpoint:      endpointChart,
+		method:        http.MethodGet,
+		path:          fmt.Sprintf(sessionChartDataAPIPath, sessionID),
+		authenticated: true,
+		attrs:         []interface{}{"session_id", sessionID},
+	}, &sResp)
 	if err != nil {
 		return nil, err
 	}
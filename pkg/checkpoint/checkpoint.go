@@ -0,0 +1,222 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Store tracks the timestamp of the last ingested point per session channel so each point is ingested once, and the
+// lifecycle events sent per session so each event is sent once. Implementations must be safe for concurrent use.
+type Store interface {
+	// Watermark returns the last ingested timestamp for the channel, or the zero time if none was ingested.
+	Watermark(sessionID int64, channel string) time.Time
+	// Advance moves the channel's watermark to ts, it never moves a watermark backwards.
+	Advance(sessionID int64, channel string, ts time.Time)
+	// Reset removes the watermarks of every channel of the session so its points are ingested again.
+	// The session's sent events are kept.
+	Reset(sessionID int64)
+	// ResetPending returns true if the session was reset and none of its points were ingested since.
+	ResetPending(sessionID int64) bool
+	// Forget removes everything kept for the session.
+	Forget(sessionID int64)
+	// Sessions returns the ids of the sessions with watermarks, sent events or resets.
+	Sessions() []int64
+	// EventSent returns true if the session's lifecycle event of kind, e.g. created, was recorded as sent.
+	EventSent(sessionID int64, kind string) bool
+	// RecordEvent records the session's lifecycle event of kind as sent.
+	RecordEvent(sessionID int64, kind string)
+	// Save persists the watermarks and sent events.
+	Save() error
+}
+
+type fileState struct {
+	Sessions map[string]map[string]time.Time `json:"sessions"`
+	Events   map[string][]string             `json:"events,omitempty"`
+	Resets   map[string]time.Time            `json:"resets,omitempty"` // when each session was last reset
+}
+
+type fileStore struct {
+	path  string
+	mu    sync.Mutex
+	state fileState
+}
+
+// NewFileStore returns a store persisted as json at path, a missing file starts with no watermarks.
+func NewFileStore(path string) (*fileStore, error) {
+	state, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileStore{path: path, state: state}, nil
+}
+
+// readState reads the state saved at path, a missing file is an empty state.
+func readState(path string) (fileState, error) {
+	state := fileState{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return state, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return state, err
+		}
+	}
+	if state.Sessions == nil {
+		state.Sessions = map[string]map[string]time.Time{}
+	}
+	if state.Events == nil {
+		state.Events = map[string][]string{}
+	}
+	if state.Resets == nil {
+		state.Resets = map[string]time.Time{}
+	}
+	return state, nil
+}
+
+func sessionKey(sessionID int64) string {
+	return strconv.FormatInt(sessionID, 10)
+}
+
+func (s *fileStore) Watermark(sessionID int64, channel string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.Sessions[sessionKey(sessionID)][channel]
+}
+
+func (s *fileStore) Advance(sessionID int64, channel string, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(sessionID)
+	channels, ok := s.state.Sessions[key]
+	if !ok {
+		channels = map[string]time.Time{}
+		s.state.Sessions[key] = channels
+	}
+	if ts.After(channels[channel]) {
+		channels[channel] = ts.UTC()
+	}
+}
+
+func (s *fileStore) Reset(sessionID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(sessionID)
+	delete(s.state.Sessions, key)
+	s.state.Resets[key] = time.Now().UTC()
+}
+
+func (s *fileStore) ResetPending(sessionID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(sessionID)
+	_, reset := s.state.Resets[key]
+	_, ingested := s.state.Sessions[key]
+	return reset && !ingested
+}
+
+func (s *fileStore) Forget(sessionID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(sessionID)
+	delete(s.state.Sessions, key)
+	delete(s.state.Events, key)
+	delete(s.state.Resets, key)
+}
+
+func (s *fileStore) Sessions() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := map[string]bool{}
+	for key := range s.state.Sessions {
+		keys[key] = true
+	}
+	for key := range s.state.Events {
+		keys[key] = true
+	}
+	for key := range s.state.Resets {
+		keys[key] = true
+	}
+	ids := make([]int64, 0, len(keys))
+	for key := range keys {
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (s *fileStore) EventSent(sessionID int64, kind string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sent := range s.state.Events[sessionKey(sessionID)] {
+		if sent == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fileStore) RecordEvent(sessionID int64, kind string) {
+	if s.EventSent(sessionID, kind) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sessionKey(sessionID)
+	s.state.Events[key] = append(s.state.Events[key], kind)
+}
+
+// Save writes the watermarks, a crash never leaves a partial file. Resets saved to the file by another process since
+// it was read, e.g. by reset-watermarks while the collector runs, are applied before writing so they are not
+// overwritten. A session without watermarks has nothing to reset, so its saved resets are dropped, as are those of
+// forgotten sessions. A file that can no longer be read is replaced.
+func (s *fileStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if saved, err := readState(s.path); err == nil {
+		for key, at := range saved.Resets {
+			if _, ok := s.state.Sessions[key]; !ok {
+				continue
+			}
+			if at.After(s.state.Resets[key]) {
+				delete(s.state.Sessions, key)
+				s.state.Resets[key] = at
+			}
+		}
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,229 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileStorePersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2022, 9, 1, 0, 35, 58, 0, time.UTC)
+	store.Advance(1, "device-a/1", ts)
+	store.Advance(1, "device-a/1", ts.Add(-time.Minute))
+	store.Advance(2, "device-a/1", ts.Add(time.Hour))
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Watermark(1, "device-a/1"); !got.Equal(ts) {
+		t.Errorf("watermark moved backwards or was not persisted: got %v, want %v", got, ts)
+	}
+	if got := reopened.Watermark(1, "device-a/2"); !got.IsZero() {
+		t.Errorf("unknown channel: got %v, want zero", got)
+	}
+
+	reopened.Reset(1)
+	if err := reopened.Save(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := again.Watermark(1, "device-a/1"); !got.IsZero() {
+		t.Errorf("reset session: got %v, want zero", got)
+	}
+	if got := again.Watermark(2, "device-a/1"); !got.Equal(ts.Add(time.Hour)) {
+		t.Errorf("reset removed another session: got %v", got)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+}
+
+func TestNewFileStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+}
+
+func TestFileSnapshotStoreRoundTrip(t *testing.T) {
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "devices.json"))
+	loaded, err := store.Load()
+	if err != nil || loaded != nil {
+		t.Fatalf("missing file: got %v, %v", loaded, err)
+	}
+
+	devices := map[string]DeviceSnapshot{
+		"device-a": {
+			UUID:        "device-a",
+			Title:       "Smoker",
+			Version:     "2.0.16",
+			Channels:    []ChannelSnapshot{{Channel: 1, Label: "Pit", Enabled: true}},
+			LogDate:     time.Date(2022, 9, 1, 0, 36, 11, 0, time.UTC),
+			Uptime:      "3:42",
+			NetworkKey:  "0a1b2c3d4e5f6071",
+			AccessPoint: "8e2f0c7a9d4b1e63",
+		},
+	}
+	if err := store.Save(devices); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, devices) {
+		t.Errorf("got %+v, want %+v", loaded, devices)
+	}
+}
+
+func TestFileStoreRecordsEventsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.RecordEvent(1, "created")
+	store.RecordEvent(1, "created")
+	store.Reset(1)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.EventSent(1, "created") {
+		t.Error("sent event was not persisted or was removed by a watermark reset")
+	}
+	if reopened.EventSent(1, "ended") || reopened.EventSent(2, "created") {
+		t.Error("unrecorded event reported as sent")
+	}
+	if got := reopened.state.Events["1"]; len(got) != 1 {
+		t.Errorf("event recorded twice: %v", got)
+	}
+}
+
+func TestFileStoreSaveKeepsResetsFromAnotherProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	ts := time.Date(2022, 9, 1, 0, 35, 58, 0, time.UTC)
+	daemon, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon.Advance(1, "device-a/1", ts)
+	daemon.Advance(2, "device-a/1", ts)
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reset-watermarks runs while the daemon keeps its watermarks in memory
+	cli, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Reset(1)
+	if err := cli.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	daemon.Advance(2, "device-a/1", ts.Add(time.Minute))
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := daemon.Watermark(1, "device-a/1"); !got.IsZero() {
+		t.Errorf("daemon kept the reset session's watermark: %v", got)
+	}
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Watermark(1, "device-a/1"); !got.IsZero() {
+		t.Errorf("the daemon's save overwrote the reset: %v", got)
+	}
+	if got := reopened.Watermark(2, "device-a/1"); !got.Equal(ts.Add(time.Minute)) {
+		t.Errorf("other session: got %v", got)
+	}
+
+	// a reset already applied is not applied again
+	daemon.Advance(1, "device-a/1", ts)
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := daemon.Watermark(1, "device-a/1"); !got.Equal(ts) {
+		t.Errorf("an applied reset was applied again: %v", got)
+	}
+}
+
+func TestFileStoreForget(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "watermarks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Advance(3, "device-a/1", time.Now())
+	store.RecordEvent(1, "created")
+	store.Advance(2, "device-a/1", time.Now())
+	store.RecordEvent(2, "ended")
+	if got := store.Sessions(); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Fatalf("got sessions %v, want [1 2 3]", got)
+	}
+	store.Forget(2)
+	if store.EventSent(2, "ended") || !store.Watermark(2, "device-a/1").IsZero() {
+		t.Error("forgotten session still has events or watermarks")
+	}
+	if got := store.Sessions(); !reflect.DeepEqual(got, []int64{1, 3}) {
+		t.Errorf("got sessions %v, want [1 3]", got)
+	}
+}
+
+func TestFileStoreSaveDropsResetsOfForgottenSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	daemon, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon.Advance(1, "device-a/1", time.Now())
+	daemon.Reset(1)
+	if !daemon.ResetPending(1) || daemon.ResetPending(2) {
+		t.Fatal("expected only session 1 to have a pending reset")
+	}
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := daemon.Sessions(); !reflect.DeepEqual(got, []int64{1}) {
+		t.Fatalf("got sessions %v, want the reset session", got)
+	}
+
+	daemon.Forget(1)
+	if err := daemon.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.state.Resets) != 0 || reopened.ResetPending(1) {
+		t.Errorf("the forgotten session's reset was saved again: %v", reopened.state.Resets)
+	}
+}
@@ -0,0 +1,75 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// DeviceSnapshot is the state of a device kept to detect its changes. Network identifiers are only kept as keyed
+// hashes, so the snapshot file does not reveal the network a device is on.
+type DeviceSnapshot struct {
+	UUID        string            `json:"uuid"`
+	Title       string            `json:"title,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	FBJVersion  string            `json:"fbj_version,omitempty"`
+	FBNVersion  string            `json:"fbn_version,omitempty"`
+	FBUVersion  string            `json:"fbu_version,omitempty"`
+	Channels    []ChannelSnapshot `json:"channels,omitempty"`
+	LogDate     time.Time         `json:"log_date,omitempty"`    // date of the device log, zero without one
+	Uptime      string            `json:"uptime,omitempty"`      // "$hours:$minutes" as reported by the device
+	NetworkKey  string            `json:"network_key,omitempty"` // identifies the key of the hashes below
+	AccessPoint string            `json:"access_point,omitempty"`
+	SSID        string            `json:"ssid,omitempty"`
+	InternalIP  string            `json:"internal_ip,omitempty"`
+	PublicIP    string            `json:"public_ip,omitempty"`
+}
+
+// ChannelSnapshot is the state of a device channel kept to detect its changes.
+type ChannelSnapshot struct {
+	Channel int64  `json:"channel"`
+	Label   string `json:"label,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// SnapshotStore persists the last seen state of each device, keyed by uuid, so changes are detected across restarts.
+type SnapshotStore interface {
+	// Load returns the saved devices, nil if none were saved.
+	Load() (map[string]DeviceSnapshot, error)
+	// Save replaces the saved devices.
+	Save(devices map[string]DeviceSnapshot) error
+}
+
+type fileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore returns a snapshot store persisted as json at path.
+func NewFileSnapshotStore(path string) *fileSnapshotStore {
+	return &fileSnapshotStore{path: path}
+}
+
+func (s *fileSnapshotStore) Load() (map[string]DeviceSnapshot, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var devices map[string]DeviceSnapshot
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (s *fileSnapshotStore) Save(devices map[string]DeviceSnapshot) error {
+	data, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// alertStatus is the value of fireboard.channel.alert_state.
+type alertStatus int
+
+const (
+	alertOK      alertStatus = 0 // the temperature is within the alert's range
+	alertPending alertStatus = 1 // out of range for less than the alert's buffer
+	alertTripped alertStatus = 2 // out of range for at least the alert's buffer
+	alertUnknown alertStatus = 3 // the channel has no fresh temperature
+)
+
+type alertState struct {
+	status alertStatus
+	since  time.Time // when the temperature left the range
+}
+
+// alertKey identifies an alert config. Alert ids are only unique per account and may be omitted, so the key includes
+// the device and channel, and the alert's position in the channel when it has no id.
+type alertKey struct {
+	device  string
+	channel int64
+	id      int64
+	index   int
+}
+
+func newAlertKey(device string, channel int64, index int, alert api.ChannelAlertConfigResponse) alertKey {
+	if alert.ID != 0 {
+		index = 0
+	}
+	return alertKey{device: device, channel: channel, id: alert.ID, index: index}
+}
+
+// aggregationKey returns the aggregation key of the alert's events, unique per alert config like the key itself.
+func (k alertKey) aggregationKey() string {
+	return fmt.Sprintf("fireboard_alert_%s_%d_%d_%d", k.device, k.channel, k.id, k.index)
+}
+
+// alertStates keeps the state of each alert config across collections.
+type alertStates struct {
+	mu     sync.Mutex
+	states map[alertKey]alertState
+}
+
+func (a *alertStates) get(key alertKey) alertState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.states[key]
+}
+
+func (a *alertStates) set(key alertKey, state alertState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.states == nil {
+		a.states = map[alertKey]alertState{}
+	}
+	a.states[key] = state
+}
+
+// alertActive returns true if the alert is enabled and now is within its window, an unset start or stop is open ended.
+func alertActive(alert api.ChannelAlertConfigResponse, now time.Time) bool {
+	if !alert.Enabled {
+		return false
+	}
+	if !alert.TimeStart.IsZero() && now.Before(alert.TimeStart) {
+		return false
+	}
+	if !alert.TimeStop.IsZero() && now.After(alert.TimeStop) {
+		return false
+	}
+	return true
+}
+
+// alertBreach returns "low" or "high" if temp is outside the alert's range, or an empty string. A zero min or max is unset.
+func alertBreach(alert api.ChannelAlertConfigResponse, temp float32) string {
+	switch {
+	case alert.TemperatureMin != 0 && temp < alert.TemperatureMin:
+		return "low"
+	case alert.TemperatureMax != 0 && temp > alert.TemperatureMax:
+		return "high"
+	}
+	return ""
+}
+
+// evaluateAlerts checks each fresh channel temperature against the channel's FireBoard alert configs and emits
+// fireboard.channel.alert_state for every active alert. An alert trips once its channel has been out of range for its
+// minutes buffer, an event is emitted when it trips and when it recovers. An alert whose channel has no fresh
+// temperature is unknown, a tripped alert becoming unknown is reset with an event rather than left tripped. Disabled
+// alerts and alerts outside their window are reset without an event. Temperatures are compared in the unit the device
+// reports them in, the same unit the alerts are configured in.
+func (c *collector) evaluateAlerts(device api.DevicePropertiesResponse, temps api.RealTimeTemperatureResponse, tags TagSet, now time.Time, stat statsd.ClientInterface) {
+	readings := make(map[int64]float32, len(temps))
+	for _, t := range temps {
+		if !t.Created.IsZero() && now.Sub(t.Created) <= maxTemperatureAge {
+			readings[t.Channel] = t.Temp
+		}
+	}
+	for _, channel := range device.Channels {
+		temp, fresh := readings[channel.Channel]
+		for i, alert := range channel.Alerts {
+			key := newAlertKey(device.UUID, channel.Channel, i, alert)
+			if !alertActive(alert, now) {
+				c.alerts.set(key, alertState{})
+				continue
+			}
+			alertTags := withChannel(tags, channel.Channel, channel.ChannelLabel).With("alert_id:" + strconv.FormatInt(alert.ID, 10))
+			prev := c.alerts.get(key)
+			state := alertState{status: alertUnknown}
+			breach := ""
+			if fresh {
+				state.status = alertOK
+				breach = alertBreach(alert, temp)
+			}
+			if breach != "" {
+				state.since = prev.since
+				if state.since.IsZero() {
+					state.since = now
+				}
+				state.status = alertPending
+				if now.Sub(state.since) >= time.Duration(alert.MinutesBuffer)*time.Minute {
+					state.status = alertTripped
+				}
+			}
+			c.alerts.set(key, state)
+			stat.Gauge("fireboard.channel.alert_state", float64(state.status), alertTags.Tags(), 1.0)
+
+			name := fmt.Sprintf("%s channel %d %q", device.Title, channel.Channel, channel.ChannelLabel)
+			event := &statsd.Event{
+				Timestamp:      now,
+				AggregationKey: key.aggregationKey(),
+				SourceTypeName: eventSourceTypeName,
+			}
+			switch {
+			case state.status == alertTripped && prev.status != alertTripped:
+				event.Title = fmt.Sprintf("FireBoard alert: %s is too %s", name, breach)
+				event.Text = fmt.Sprintf("%s is %.1f, outside %.1f to %.1f since %s", name, temp, alert.TemperatureMin, alert.TemperatureMax, state.since.Format(time.RFC3339))
+				event.AlertType = statsd.Error
+				event.Tags = alertTags.With("alert_transition:triggered", "breach:"+breach).Tags()
+			case state.status == alertOK && prev.status == alertTripped:
+				event.Title = fmt.Sprintf("FireBoard alert recovered: %s", name)
+				event.Text = fmt.Sprintf("%s is %.1f, back within %.1f to %.1f", name, temp, alert.TemperatureMin, alert.TemperatureMax)
+				event.AlertType = statsd.Success
+				event.Tags = alertTags.With("alert_transition:recovered").Tags()
+			case state.status == alertUnknown && prev.status == alertTripped:
+				event.Title = fmt.Sprintf("FireBoard alert unknown: %s", name)
+				event.Text = fmt.Sprintf("%s has no temperature from the last %s, the alert is reset", name, maxTemperatureAge)
+				event.AlertType = statsd.Warning
+				event.Tags = alertTags.With("alert_transition:unknown").Tags()
+			default:
+				continue
+			}
+			c.logger.Info("channel alert", "device_uuid", device.UUID, "channel", channel.Channel, "alert_id", alert.ID, "event", event.Title)
+			stat.Event(event)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestEvaluateAlertsRespectsBufferAndWindow(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	device := api.DevicePropertiesResponse{
+		UUID:  "device-a",
+		Title: "Smoker",
+		Channels: []api.ChannelResponse{{
+			Channel:      1,
+			ChannelLabel: "Pit",
+			Alerts: []api.ChannelAlertConfigResponse{
+				{ID: 10, Enabled: true, TemperatureMin: 200, TemperatureMax: 275, MinutesBuffer: 5},
+				{ID: 11, Enabled: false, TemperatureMax: 100},
+				{ID: 12, Enabled: true, TemperatureMax: 100, TimeStart: start.Add(time.Hour)},
+			},
+		}},
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetLogger(nil)
+
+	steps := []struct {
+		offset time.Duration
+		temp   float32
+		state  float64
+		event  string
+	}{
+		{0, 250, 0, ""},
+		{time.Minute, 290, 1, ""},
+		{4 * time.Minute, 300, 1, ""},
+		{6 * time.Minute, 280, 2, "triggered"},
+		{7 * time.Minute, 285, 2, ""},
+		{8 * time.Minute, 260, 0, "recovered"},
+		{9 * time.Minute, 150, 1, ""},
+	}
+	for _, step := range steps {
+		now := start.Add(step.offset)
+		stat := &recordingStat{}
+		temps := api.RealTimeTemperatureResponse{{Channel: 1, Temp: step.temp, Created: now.Add(-10 * time.Second)}}
+		c.evaluateAlerts(device, temps, NewTagSet("uuid:device-a"), now, stat)
+
+		states := stat.named("fireboard.channel.alert_state")
+		if len(states) != 1 {
+			t.Fatalf("%s: got %d alert states, want only the enabled alert in its window", step.offset, len(states))
+		}
+		if states[0].value != step.state || !states[0].hasTag("alert_id:10") || !states[0].hasTag("channel:1") {
+			t.Errorf("%s: got state %v with tags %v, want %v", step.offset, states[0].value, states[0].tags, step.state)
+		}
+		var transitions []string
+		for _, e := range stat.events {
+			transitions = append(transitions, metric{tags: e.Tags}.tagWithPrefix("alert_transition:")...)
+			if e.AggregationKey != "fireboard_alert_device-a_1_10_0" {
+				t.Errorf("%s: aggregation key %s", step.offset, e.AggregationKey)
+			}
+		}
+		want := []string{}
+		if step.event != "" {
+			want = append(want, "alert_transition:"+step.event)
+		}
+		if len(transitions) != len(want) || (len(want) == 1 && transitions[0] != want[0]) {
+			t.Errorf("%s: got events %v, want %v", step.offset, transitions, want)
+		}
+		if step.event == "triggered" && stat.events[0].AlertType != statsd.Error {
+			t.Errorf("triggered event alert type %s", stat.events[0].AlertType)
+		}
+	}
+}
+
+func TestEvaluateAlertsResetsTrippedAlertWithoutReading(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	device := api.DevicePropertiesResponse{
+		UUID:     "device-a",
+		Channels: []api.ChannelResponse{{Channel: 1, Alerts: []api.ChannelAlertConfigResponse{{ID: 1, Enabled: true, TemperatureMax: 100}}}},
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetLogger(nil)
+
+	steps := []struct {
+		offset time.Duration
+		age    time.Duration // age of the reading
+		temp   float32
+		state  float64
+		event  string
+	}{
+		{0, time.Hour, 500, 3, ""}, // stale reading of an untripped alert
+		{time.Minute, 0, 500, 2, "triggered"},
+		{2 * time.Minute, time.Hour, 500, 3, "unknown"},
+		{3 * time.Minute, time.Hour, 500, 3, ""},
+		{4 * time.Minute, 0, 50, 0, ""}, // already reset, no recovery
+		{5 * time.Minute, 0, 500, 2, "triggered"},
+	}
+	for _, step := range steps {
+		now := start.Add(step.offset)
+		stat := &recordingStat{}
+		temps := api.RealTimeTemperatureResponse{{Channel: 1, Temp: step.temp, Created: now.Add(-step.age)}}
+		c.evaluateAlerts(device, temps, TagSet{}, now, stat)
+
+		if states := stat.named("fireboard.channel.alert_state"); len(states) != 1 || states[0].value != step.state {
+			t.Errorf("%s: got states %v, want %v", step.offset, states, step.state)
+		}
+		var transitions []string
+		for _, e := range stat.events {
+			transitions = append(transitions, metric{tags: e.Tags}.tagWithPrefix("alert_transition:")...)
+		}
+		want := ""
+		if step.event != "" {
+			want = "alert_transition:" + step.event
+		}
+		if got := strings.Join(transitions, ","); got != want {
+			t.Errorf("%s: got events %v, want %q", step.offset, transitions, want)
+		}
+	}
+}
+
+func TestEvaluateAlertsKeysStateByDeviceAndChannel(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	alerts := []api.ChannelAlertConfigResponse{{Enabled: true, TemperatureMax: 100}, {Enabled: true, TemperatureMax: 200}}
+	device := func(uuid string) api.DevicePropertiesResponse {
+		return api.DevicePropertiesResponse{UUID: uuid, Channels: []api.ChannelResponse{{Channel: 1, Alerts: alerts}, {Channel: 2, Alerts: alerts}}}
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetLogger(nil)
+
+	// alerts without an id on channels and devices that share an alert id must not share state
+	stat := &recordingStat{}
+	c.evaluateAlerts(device("device-a"), api.RealTimeTemperatureResponse{{Channel: 1, Temp: 150, Created: now}, {Channel: 2, Temp: 50, Created: now}}, TagSet{}, now, stat)
+	c.evaluateAlerts(device("device-b"), api.RealTimeTemperatureResponse{{Channel: 1, Temp: 50, Created: now}, {Channel: 2, Temp: 50, Created: now}}, TagSet{}, now, stat)
+	if len(stat.events) != 1 {
+		t.Fatalf("got %d events, want only the first alert of device-a channel 1", len(stat.events))
+	}
+	first := stat.events[0].AggregationKey
+
+	stat = &recordingStat{}
+	c.evaluateAlerts(device("device-a"), api.RealTimeTemperatureResponse{{Channel: 1, Temp: 150, Created: now}, {Channel: 2, Temp: 50, Created: now}}, TagSet{}, now.Add(time.Minute), stat)
+	c.evaluateAlerts(device("device-b"), api.RealTimeTemperatureResponse{{Channel: 1, Temp: 150, Created: now}, {Channel: 2, Temp: 50, Created: now}}, TagSet{}, now.Add(time.Minute), stat)
+	var got []float64
+	for _, m := range stat.named("fireboard.channel.alert_state") {
+		got = append(got, m.value)
+	}
+	if want := []float64{2, 0, 0, 0, 2, 0, 0, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got states %v, want %v", got, want)
+	}
+	if len(stat.events) != 1 {
+		t.Fatalf("got %d events, want only device-b tripping", len(stat.events))
+	}
+	if got := stat.events[0].AggregationKey; got != "fireboard_alert_device-b_1_0_0" || got == first {
+		t.Errorf("got aggregation key %s for device-b after %s for device-a, want one per alert", got, first)
+	}
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const (
+	// batteryTrendWindow is how far back battery samples are kept for the discharge trend
+	batteryTrendWindow = time.Hour
+	// batteryMinTrendSpan is the minimum time between the oldest and newest sample before a trend is reported
+	batteryMinTrendSpan = 10 * time.Minute
+	// batteryDeadband is the trend, in percent per second, a battery has to rise or fall by to switch between charging
+	// and discharging, so a flat battery does not flap between the two; one percent per hour
+	batteryDeadband = 1.0 / 3600
+	// batteryFullPercent is the percent at which a battery that is holding steady is taken to be on mains power
+	batteryFullPercent = 99
+)
+
+type batterySample struct {
+	at      time.Time
+	percent float64
+}
+
+// batteryTrends keeps recent battery samples and whether the battery is charging per device uuid across collections.
+type batteryTrends struct {
+	mu       sync.Mutex
+	samples  map[string][]batterySample
+	charging map[string]bool
+}
+
+// add records a sample for the device, dropping samples older than batteryTrendWindow, and returns the samples.
+// A sample with the same time as the newest one is ignored since the device log has not been updated.
+func (b *batteryTrends) add(uuid string, sample batterySample) []batterySample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.samples == nil {
+		b.samples = map[string][]batterySample{}
+	}
+	samples := b.samples[uuid]
+	if n := len(samples); n == 0 || sample.at.After(samples[n-1].at) {
+		samples = append(samples, sample)
+	}
+	oldest := sample.at.Add(-batteryTrendWindow)
+	for len(samples) > 0 && samples[0].at.Before(oldest) {
+		samples = samples[1:]
+	}
+	b.samples[uuid] = samples
+	return append([]batterySample(nil), samples...)
+}
+
+// isCharging returns whether the device's battery is charging at rate percent per second. A rate within
+// batteryDeadband of flat keeps the device's previous state, not charging if it has none.
+func (b *batteryTrends) isCharging(uuid string, rate float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.charging == nil {
+		b.charging = map[string]bool{}
+	}
+	switch {
+	case rate > batteryDeadband:
+		b.charging[uuid] = true
+	case rate < -batteryDeadband:
+		b.charging[uuid] = false
+	}
+	return b.charging[uuid]
+}
+
+// dischargeRate returns the least squares slope of the samples in percent per second, false if they span less than
+// batteryMinTrendSpan.
+func dischargeRate(samples []batterySample) (float64, bool) {
+	if len(samples) < 2 || samples[len(samples)-1].at.Sub(samples[0].at) < batteryMinTrendSpan {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(samples))
+	for _, s := range samples {
+		x := s.at.Sub(samples[0].at).Seconds()
+		sumX += x
+		sumY += s.percent
+		sumXY += x * s.percent
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+// emitBattery emits the battery voltage and percent, whether the device is on mains power, and whether it is charging
+// and the estimated seconds until empty from the discharge trend of recent collections. Devices that have never
+// reported a battery voltage are skipped.
+func (c *collector) emitBattery(device api.DevicePropertiesResponse, tags TagSet, stat statsd.ClientInterface) {
+	deviceLog := device.DeviceLog
+	voltage := deviceLog.VoltageBattery
+	if voltage == 0 {
+		voltage = device.LastBatteryReading
+	}
+	if voltage == 0 {
+		return
+	}
+	stat.Gauge("fireboard.device.battery.voltage", float64(voltage), tags.Tags(), 1.0)
+	if deviceLog.VoltageBatterPercentRaw > 0 {
+		stat.Gauge("fireboard.device.battery.percent_raw", float64(deviceLog.VoltageBatterPercentRaw)*100, tags.Tags(), 1.0)
+	}
+	onMains, ok := c.emitBatteryPercent(device, tags, stat)
+	// the drive's power mode is preferred over the trend
+	switch strings.ToLower(device.LastDriveLog.PowerMode) {
+	case "mains":
+		onMains, ok = true, true
+	case "battery":
+		onMains, ok = false, true
+	}
+	if ok {
+		stat.Gauge("fireboard.device.battery.on_mains", boolGauge(onMains), tags.Tags(), 1.0)
+	}
+}
+
+// emitBatteryPercent emits the battery percent, and once the trend is known whether the battery is charging and the
+// time to empty while discharging. It returns whether the trend shows the device on mains power: charging or holding
+// steady at full, or on battery: discharging, false if the trend does not tell.
+func (c *collector) emitBatteryPercent(device api.DevicePropertiesResponse, tags TagSet, stat statsd.ClientInterface) (onMains, ok bool) {
+	deviceLog := device.DeviceLog
+	// the percent is only reported with the device log's voltage, an empty battery reports 0
+	if deviceLog.VoltageBattery == 0 || deviceLog.VoltageBatteryPercent < 0 {
+		return false, false
+	}
+	percent := float64(deviceLog.VoltageBatteryPercent) * 100
+	stat.Gauge("fireboard.device.battery.percent", percent, tags.Tags(), 1.0)
+
+	if deviceLog.Date.IsZero() {
+		return false, false
+	}
+	rate, ok := dischargeRate(c.battery.add(device.UUID, batterySample{at: deviceLog.Date, percent: percent}))
+	if !ok {
+		return false, false
+	}
+	charging := c.battery.isCharging(device.UUID, rate)
+	stat.Gauge("fireboard.device.battery.charging", boolGauge(charging), tags.Tags(), 1.0)
+	switch {
+	case charging:
+		return true, true
+	case rate < -batteryDeadband:
+		stat.Gauge("fireboard.device.battery.time_to_empty", percent/-rate, tags.Tags(), 1.0)
+		return false, true
+	case percent >= batteryFullPercent:
+		return true, true
+	}
+	return false, false
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// collectBattery runs a collection per percent, ten minutes apart, for a device without a drive and returns the values
+// emitted for each battery metric.
+func collectBattery(t *testing.T, percents ...float32) map[string][]float64 {
+	t.Helper()
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeClient{}
+	c, stat := newTestCollector(client)
+	for i, percent := range percents {
+		client.devices = api.ListDevicesResponse{{
+			UUID: "device-a", Active: true,
+			DeviceLog: api.DeviceLog{VoltageBattery: 3.5, VoltageBatteryPercent: percent, Date: start.Add(time.Duration(i) * 10 * time.Minute)},
+		}}
+		mustCollect(t, c, time.Now())
+	}
+	out := map[string][]float64{}
+	for _, name := range []string{"percent", "charging", "on_mains", "time_to_empty"} {
+		for _, m := range stat.named("fireboard.device.battery." + name) {
+			out[name] = append(out[name], m.value)
+		}
+	}
+	return out
+}
+
+func TestEmitBatteryReportsEmpty(t *testing.T) {
+	got := collectBattery(t, 0)
+	if len(got["percent"]) != 1 || got["percent"][0] != 0 {
+		t.Errorf("got percent %v, want an empty battery reported as 0", got["percent"])
+	}
+}
+
+func TestEmitBatteryInfersOnMainsFromTrend(t *testing.T) {
+	tests := []struct {
+		name     string
+		percents []float32
+		want     []float64 // on mains after each trend
+	}{
+		{"discharging", []float32{0.8, 0.7, 0.6}, []float64{0, 0}},
+		{"charging", []float32{0.5, 0.6, 0.7}, []float64{1, 1}},
+		{"full", []float32{1, 1, 1}, []float64{1, 1}},
+		{"steady", []float32{0.5, 0.5, 0.5}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectBattery(t, tt.percents...)
+			if len(got["on_mains"]) != len(tt.want) {
+				t.Fatalf("got on mains %v, want %v", got["on_mains"], tt.want)
+			}
+			for i := range tt.want {
+				if got["on_mains"][i] != tt.want[i] {
+					t.Errorf("got on mains %v, want %v", got["on_mains"], tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBatteryChargingDeadband(t *testing.T) {
+	var b batteryTrends
+	perHour := func(percent float64) float64 { return percent / 3600 }
+	steps := []struct {
+		rate float64
+		want bool
+	}{
+		{perHour(0.5), false}, // within the deadband without a previous state
+		{perHour(5), true},
+		{perHour(-0.5), true}, // a flat battery stays charging
+		{perHour(0.5), true},
+		{perHour(-5), false},
+		{perHour(0.9), false},
+	}
+	for i, step := range steps {
+		if got := b.isCharging("device-a", step.rate); got != step.want {
+			t.Errorf("step %d: got charging %v at %v percent per hour, want %v", i, got, step.rate*3600, step.want)
+		}
+	}
+	if b.isCharging("device-b", perHour(0.9)) {
+		t.Error("charging state leaked across devices")
+	}
+}
+
+func TestCollectEmitsBatteryAndTimeToEmpty(t *testing.T) {
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	device := api.DevicePropertiesResponse{
+		UUID: "device-a", Active: true, LastBatteryReading: 4.1,
+		LastDriveLog: api.DriveLogResponse{PowerMode: "Battery"},
+		DeviceLog:    api.DeviceLog{VoltageBattery: 4.02, VoltageBatterPercentRaw: 0.85},
+	}
+	client := &fakeClient{}
+	c, stat := newTestCollector(client)
+	// the third collection sees the same device log as the second
+	offsets := []time.Duration{0, 5 * time.Minute, 5 * time.Minute, 10 * time.Minute}
+	for i, percent := range []float32{0.87, 0.86, 0.86, 0.85} {
+		d := device
+		d.DeviceLog.VoltageBatteryPercent = percent
+		d.DeviceLog.Date = start.Add(offsets[i])
+		client.devices = api.ListDevicesResponse{d}
+		mustCollect(t, c, time.Now())
+	}
+
+	last := func(name string) (float64, int) {
+		got := stat.named(name)
+		if len(got) == 0 {
+			return 0, 0
+		}
+		return got[len(got)-1].value, len(got)
+	}
+	if v, n := last("fireboard.device.battery.voltage"); v != float64(float32(4.02)) || n != 4 {
+		t.Errorf("voltage: got %v from %d emissions", v, n)
+	}
+	if v, _ := last("fireboard.device.battery.percent"); v != float64(float32(0.85))*100 {
+		t.Errorf("percent: got %v", v)
+	}
+	if v, _ := last("fireboard.device.battery.percent_raw"); v != float64(float32(0.85))*100 {
+		t.Errorf("raw percent: got %v", v)
+	}
+	if v, n := last("fireboard.device.battery.on_mains"); v != 0 || n != 4 {
+		t.Errorf("on mains: got %v from %d emissions", v, n)
+	}
+	if v, n := last("fireboard.device.battery.charging"); v != 0 || n != 1 {
+		t.Errorf("charging: got %v from %d emissions, want one trend after 10 minutes", v, n)
+	}
+	// two percent over ten minutes leaves 85% for 425 minutes
+	if v, _ := last("fireboard.device.battery.time_to_empty"); v < 424*60 || v > 426*60 {
+		t.Errorf("time to empty: got %v seconds", v)
+	}
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// bufferedStat records emissions so work done concurrently can be flushed in a deterministic order.
+// Close, Flush, IsClosed and GetTelemetry pass through to the wrapped client.
+type bufferedStat struct {
+	statsd.ClientInterface
+	ops []func(stat statsd.ClientInterface)
+}
+
+func newBufferedStat(stat statsd.ClientInterface) *bufferedStat {
+	return &bufferedStat{ClientInterface: stat}
+}
+
+// flush replays the recorded emissions to the wrapped client in order.
+func (b *bufferedStat) flush() {
+	for _, op := range b.ops {
+		op(b.ClientInterface)
+	}
+	b.ops = nil
+}
+
+func (b *bufferedStat) record(op func(stat statsd.ClientInterface)) error {
+	b.ops = append(b.ops, op)
+	return nil
+}
+
+func (b *bufferedStat) Gauge(name string, value float64, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Gauge(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Count(name string, value int64, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Count(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Histogram(name string, value float64, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Histogram(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Distribution(name string, value float64, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Distribution(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Decr(name string, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Decr(name, tags, rate) })
+}
+
+func (b *bufferedStat) Incr(name string, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Incr(name, tags, rate) })
+}
+
+func (b *bufferedStat) Set(name string, value string, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Set(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Timing(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.TimeInMilliseconds(name, value, tags, rate) })
+}
+
+func (b *bufferedStat) Event(e *statsd.Event) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.Event(e) })
+}
+
+func (b *bufferedStat) SimpleEvent(title, text string) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.SimpleEvent(title, text) })
+}
+
+func (b *bufferedStat) ServiceCheck(sc *statsd.ServiceCheck) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.ServiceCheck(sc) })
+}
+
+func (b *bufferedStat) SimpleServiceCheck(name string, status statsd.ServiceCheckStatus) error {
+	return b.record(func(stat statsd.ClientInterface) { _ = stat.SimpleServiceCheck(name, status) })
+}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+)
+
+// deviceChange is a meaningful difference between two snapshots of a device.
+type deviceChange struct {
+	kind string // reboot, firmware, access_point, ssid, ip, renamed, added, removed or channel
+	text string
+}
+
+// SetSnapshotStore persists the device snapshots used for change detection in store so changes made while the
+// collector was stopped are detected.
+func (c *collector) SetSnapshotStore(store checkpoint.SnapshotStore) {
+	c.snapshotStore = store
+}
+
+// deviceSnapshot returns the state of device kept to detect its changes. Network identifiers are hashed with the hash
+// secret, or with a key of this process without one, in which case they are only compared until a restart.
+func (c *collector) deviceSnapshot(device api.DevicePropertiesResponse) checkpoint.DeviceSnapshot {
+	snapshot := checkpoint.DeviceSnapshot{
+		UUID:       device.UUID,
+		Title:      device.Title,
+		Version:    device.Version,
+		FBJVersion: device.FireBoardJVersion,
+		FBNVersion: device.FireBoardNVersion,
+		FBUVersion: device.FireBoardUVersion,
+		LogDate:    device.DeviceLog.Date,
+		Uptime:     device.DeviceLog.Uptime,
+	}
+	for _, ch := range device.Channels {
+		snapshot.Channels = append(snapshot.Channels, checkpoint.ChannelSnapshot{Channel: ch.Channel, Label: ch.ChannelLabel, Enabled: ch.Enabled})
+	}
+
+	key := c.hashSecret
+	if len(key) == 0 {
+		key = c.processKey
+	}
+	hash := func(v string) string {
+		if v = strings.ToLower(strings.TrimSpace(v)); v == "" {
+			return ""
+		}
+		return keyedHash(key, v)
+	}
+	snapshot.NetworkKey = keyedHash(key, "network key")
+	snapshot.AccessPoint = hash(device.DeviceLog.AccesPointMAC)
+	snapshot.SSID = hash(device.DeviceLog.SSID)
+	snapshot.InternalIP = hash(device.DeviceLog.InternalIP)
+	snapshot.PublicIP = hash(device.DeviceLog.PublicIP)
+	return snapshot
+}
+
+// compareDevices returns the changes from prev to cur. Device log changes are only compared when both have a device log,
+// network changes only when both were hashed with the same key. Network addresses are left out of the text.
+func compareDevices(prev, cur checkpoint.DeviceSnapshot) []deviceChange {
+	var changes []deviceChange
+	if prev.Title != cur.Title {
+		changes = append(changes, deviceChange{"renamed", fmt.Sprintf("renamed from %q to %q", prev.Title, cur.Title)})
+	}
+	for _, v := range []struct{ name, prev, cur string }{
+		{"firmware", prev.Version, cur.Version},
+		{"fbj", prev.FBJVersion, cur.FBJVersion},
+		{"fbn", prev.FBNVersion, cur.FBNVersion},
+		{"fbu", prev.FBUVersion, cur.FBUVersion},
+	} {
+		if v.prev != v.cur && v.cur != "" {
+			changes = append(changes, deviceChange{"firmware", fmt.Sprintf("%s version changed from %s to %s", v.name, v.prev, v.cur)})
+		}
+	}
+
+	prevChannels := map[int64]bool{}
+	for _, ch := range prev.Channels {
+		prevChannels[ch.Channel] = ch.Enabled
+	}
+	for _, ch := range cur.Channels {
+		if enabled, ok := prevChannels[ch.Channel]; ok && enabled != ch.Enabled {
+			state := "disabled"
+			if ch.Enabled {
+				state = "enabled"
+			}
+			changes = append(changes, deviceChange{"channel", fmt.Sprintf("channel %d %q %s", ch.Channel, ch.Label, state)})
+		}
+	}
+
+	if prev.LogDate.IsZero() || cur.LogDate.IsZero() || !cur.LogDate.After(prev.LogDate) {
+		return changes
+	}
+	prevUptime := api.DeviceLog{Uptime: prev.Uptime}.UptimeSeconds()
+	if curUptime := (api.DeviceLog{Uptime: cur.Uptime}).UptimeSeconds(); curUptime > 0 && curUptime < prevUptime {
+		changes = append(changes, deviceChange{"reboot", fmt.Sprintf("rebooted, uptime dropped from %s to %s", prev.Uptime, cur.Uptime)})
+	}
+	if prev.NetworkKey != cur.NetworkKey {
+		return changes
+	}
+	if prev.AccessPoint != cur.AccessPoint && prev.AccessPoint != "" && cur.AccessPoint != "" {
+		changes = append(changes, deviceChange{"access_point", "roamed to a different wifi access point"})
+	}
+	if prev.SSID != cur.SSID && prev.SSID != "" && cur.SSID != "" {
+		changes = append(changes, deviceChange{"ssid", "joined a different wifi network"})
+	}
+	if prev.InternalIP != cur.InternalIP && prev.InternalIP != "" && cur.InternalIP != "" {
+		changes = append(changes, deviceChange{"ip", "internal ip address changed"})
+	}
+	if prev.PublicIP != cur.PublicIP && prev.PublicIP != "" && cur.PublicIP != "" {
+		changes = append(changes, deviceChange{"ip", "public ip address changed"})
+	}
+	return changes
+}
+
+// detectDeviceChanges emits an event for each change since the previous snapshot of the devices, including devices
+// added to or removed from the account, then saves devices as the new snapshot. Nothing is emitted the first time
+// devices are seen without a saved snapshot.
+func (c *collector) detectDeviceChanges(devices api.ListDevicesResponse, stat statsd.ClientInterface) {
+	if c.snapshots == nil && c.snapshotStore != nil {
+		loaded, err := c.snapshotStore.Load()
+		if err != nil {
+			stat.Incr("fireboard.devices.errors", c.tags.With("func:snapshotLoad").Tags(), 1.0)
+			c.logger.Error("unable to load device snapshots", "func", "snapshotLoad", "error", err)
+		}
+		c.snapshots = loaded
+	}
+
+	current := make(map[string]checkpoint.DeviceSnapshot, len(devices))
+	for _, device := range devices {
+		current[device.UUID] = c.deviceSnapshot(device)
+	}
+	if c.snapshots != nil {
+		for _, device := range devices {
+			prev, ok := c.snapshots[device.UUID]
+			if !ok {
+				c.emitDeviceChange(device.UUID, device.Title, deviceChange{"added", "added to the account"}, stat)
+				continue
+			}
+			for _, change := range compareDevices(prev, current[device.UUID]) {
+				c.emitDeviceChange(device.UUID, device.Title, change, stat)
+			}
+		}
+		var removed []string
+		for uuid := range c.snapshots {
+			if _, ok := current[uuid]; !ok {
+				removed = append(removed, uuid)
+			}
+		}
+		sort.Strings(removed)
+		for _, uuid := range removed {
+			c.emitDeviceChange(uuid, c.snapshots[uuid].Title, deviceChange{"removed", "removed from the account"}, stat)
+		}
+	}
+	c.snapshots = current
+
+	if c.snapshotStore != nil {
+		if err := c.snapshotStore.Save(current); err != nil {
+			stat.Incr("fireboard.devices.errors", c.tags.With("func:snapshotSave").Tags(), 1.0)
+			c.logger.Error("unable to save device snapshots", "func", "snapshotSave", "error", err)
+		}
+	}
+}
+
+// emitDeviceChange emits a change as an event grouped with the device's other changes.
+func (c *collector) emitDeviceChange(uuid, title string, change deviceChange, stat statsd.ClientInterface) {
+	name := title
+	if name == "" {
+		name = uuid
+	}
+	c.logger.Info("device changed", "device_uuid", uuid, "change", change.kind, "detail", change.text)
+	stat.Event(&statsd.Event{
+		Title:          fmt.Sprintf("FireBoard device %s: %s", name, change.text),
+		Text:           fmt.Sprintf("%s (%s) %s", name, uuid, change.text),
+		AggregationKey: "fireboard_device_" + uuid,
+		SourceTypeName: eventSourceTypeName,
+		AlertType:      statsd.Info,
+		Tags:           c.tags.With("uuid:"+uuid, "device_change:"+change.kind).Tags(),
+	})
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+)
+
+func TestCollectDetectsDeviceChanges(t *testing.T) {
+	date := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	before := api.DevicePropertiesResponse{
+		UUID: "device-a", Title: "Smoker", Version: "2.0.16",
+		Channels:  []api.ChannelResponse{{Channel: 1, ChannelLabel: "Pit", Enabled: true}, {Channel: 2, ChannelLabel: "Meat"}},
+		DeviceLog: api.DeviceLog{Date: date, Uptime: "121:07", AccesPointMAC: "ap-1", SSID: "home", InternalIP: "10.0.0.2", PublicIP: "8.8.8.8"},
+	}
+	after := before
+	after.Title = "Big Smoker"
+	after.Version = "2.1.0"
+	after.Channels = []api.ChannelResponse{{Channel: 1, ChannelLabel: "Pit", Enabled: true}, {Channel: 2, ChannelLabel: "Meat", Enabled: true}}
+	after.DeviceLog = api.DeviceLog{Date: date.Add(time.Minute), Uptime: "0:01", AccesPointMAC: "ap-2", SSID: "trailer", InternalIP: "10.0.0.3", PublicIP: "8.8.8.8"}
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	secret := []byte("secret")
+	collect := func(devices ...api.DevicePropertiesResponse) []*statsd.Event {
+		t.Helper()
+		c, stat := newTestCollector(&fakeClient{devices: devices})
+		c.SetHashSecret(secret)
+		c.SetSnapshotStore(checkpoint.NewFileSnapshotStore(path))
+		mustCollect(t, c, time.Now())
+		return stat.events
+	}
+	changes := func(events []*statsd.Event) []string {
+		var out []string
+		for _, e := range events {
+			m := metric{tags: e.Tags}
+			change := m.tagWithPrefix("device_change:")
+			uuid := m.tagWithPrefix("uuid:")
+			if len(change) != 1 || len(uuid) != 1 || e.AggregationKey != "fireboard_device_"+strings.TrimPrefix(uuid[0], "uuid:") {
+				t.Errorf("event %q: tags %v, aggregation key %s", e.Title, e.Tags, e.AggregationKey)
+				continue
+			}
+			out = append(out, strings.TrimPrefix(uuid[0], "uuid:")+" "+strings.TrimPrefix(change[0], "device_change:"))
+		}
+		return out
+	}
+
+	if got := collect(before); len(got) != 0 {
+		t.Errorf("first collection: got %v, want no events", changes(got))
+	}
+	// every collection is a new collector, so the previous snapshot must come from the store
+	events := collect(after, api.DevicePropertiesResponse{UUID: "device-b"})
+	want := "device-a renamed,device-a firmware,device-a channel,device-a reboot,device-a access_point,device-a ssid,device-a ip,device-b added"
+	if got := strings.Join(changes(events), ","); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	for _, e := range events {
+		if strings.Contains(e.Text, "10.0.0") || strings.Contains(e.Text, "ap-") || strings.Contains(e.Text, "trailer") {
+			t.Errorf("network details in event text: %s", e.Text)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, plain := range []string{"ap-2", "trailer", "10.0.0.3", "8.8.8.8"} {
+		if bytes.Contains(data, []byte(plain)) {
+			t.Errorf("snapshot file contains %q:\n%s", plain, data)
+		}
+	}
+	if got := strings.Join(changes(collect(after)), ","); got != "device-b removed" {
+		t.Errorf("got %s, want device-b removed", got)
+	}
+
+	// without a secret every process hashes with its own key, so network changes are not compared across restarts
+	secret = nil
+	collect(before)
+	if got := strings.Join(changes(collect(after)), ","); got != "device-a renamed,device-a firmware,device-a channel,device-a reboot" {
+		t.Errorf("without a secret: got %s", got)
+	}
+}
@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/series"
+)
+
+// sessionChart is the chart points of a single session channel that have not been ingested yet.
+type sessionChart struct {
+	sessionID int64
+	channel   string // device/channel identifying the channel in the checkpoint store
+	series    series.Series
+}
+
+// chartChannel returns the checkpoint key of a chart object, the channel id or the label when there is none.
+func chartChannel(sensor api.SessionChartObject) string {
+	channel := sensor.ChannelID.String()
+	if channel == "" {
+		channel = sensor.Label
+	}
+	return sensor.Device + "/" + channel
+}
+
+// pendingChart converts the chart points after each channel's watermark, or cutoff if it has none, into
+// fireboard.sessions.chart series, one per channel.
+func (c *collector) pendingChart(sessionID int64, chart api.SessionChartResponse, cutoff time.Time, tags TagSet) []sessionChart {
+	var out []sessionChart
+	for _, sensor := range chart {
+		conversion := unity
+		if sensor.DegreeType == 2 {
+			conversion = fToC
+		}
+		// fixme for non temp sensors ^^^
+		pending := sessionChart{
+			sessionID: sessionID,
+			channel:   chartChannel(sensor),
+			series: series.Series{
+				Metric: "fireboard.sessions.chart",
+				Tags:   tags.With("label:"+sensor.Label, "device_id:"+sensor.Device).Tags(),
+			},
+		}
+		since := cutoff
+		if c.checkpoints != nil {
+			if watermark := c.checkpoints.Watermark(sessionID, pending.channel); !watermark.IsZero() {
+				since = watermark
+			}
+		}
+		for i := 0; i < len(sensor.X) && i < len(sensor.Y); i++ {
+			d := time.Unix(sensor.X[i], 0)
+			if d.After(since) {
+				pending.series.Points = append(pending.series.Points, series.Point{Timestamp: d, Value: float64(conversion(sensor.Y[i]))})
+			}
+		}
+		if len(pending.series.Points) > 0 {
+			out = append(out, pending)
+		}
+	}
+	return out
+}
+
+// emitRecentChart sends the chart points from the last maxChartGaugeAge as statsd gauges, it returns the number sent.
+// Older points are dropped since statsd stamps them with the time they are received.
+func emitRecentChart(chart []sessionChart, stat statsd.ClientInterface) int {
+	points := 0
+	oldest := time.Now().Add(-maxChartGaugeAge)
+	for _, pending := range chart {
+		for _, p := range pending.series.Points {
+			if p.Timestamp.After(oldest) {
+				stat.Gauge(pending.series.Metric, p.Value, pending.series.Tags, 1.0)
+				points++
+			}
+		}
+	}
+	return points
+}
+
+// submitCharts sends every session's chart points to the series sink in a single submission, it returns the number sent.
+func (c *collector) submitCharts(ctx context.Context, charts []sessionChart, stat statsd.ClientInterface) (int, error) {
+	all := make([]series.Series, 0, len(charts))
+	points := 0
+	for _, pending := range charts {
+		all = append(all, pending.series)
+		points += len(pending.series.Points)
+	}
+	if len(all) == 0 {
+		return 0, nil
+	}
+	if err := c.sink.Submit(ctx, all); err != nil {
+		stat.Incr("fireboard.sessions.errors", c.tags.With("func:seriesSubmit").Tags(), 1.0)
+		c.logger.Error("unable to submit chart series", "func", "seriesSubmit", "points", points, "error", err)
+		return 0, err
+	}
+	return points, nil
+}
+
+// advanceWatermarks moves each channel's watermark to its newest ingested point and saves the checkpoint store, which
+// also holds the session events sent by the collection.
+func (c *collector) advanceWatermarks(charts []sessionChart, stat statsd.ClientInterface) error {
+	if c.checkpoints == nil {
+		return nil
+	}
+	for _, pending := range charts {
+		var newest time.Time
+		for _, p := range pending.series.Points {
+			if p.Timestamp.After(newest) {
+				newest = p.Timestamp
+			}
+		}
+		c.checkpoints.Advance(pending.sessionID, pending.channel, newest)
+	}
+	if err := c.checkpoints.Save(); err != nil {
+		stat.Incr("fireboard.sessions.errors", c.tags.With("func:checkpointSave").Tags(), 1.0)
+		c.logger.Error("unable to save checkpoints", "func", "checkpointSave", "error", err)
+		return err
+	}
+	return nil
+}
+
+// pruneCheckpoints forgets the watermarks, sent events and resets of sessions that are no longer listed or that ended
+// more than checkpointRetention before the cutoff, so the checkpoint store does not grow without bound. A listed
+// session with a pending reset is kept until it is ingested again.
+func (c *collector) pruneCheckpoints(sessions api.SessionsListResponse, cutoff time.Time) {
+	if c.checkpoints == nil {
+		return
+	}
+	ended := make(map[int64]time.Time, len(sessions))
+	for _, session := range sessions {
+		ended[session.ID] = session.EndTime
+	}
+	oldest := cutoff.Add(-checkpointRetention)
+	for _, id := range c.checkpoints.Sessions() {
+		end, listed := ended[id]
+		if !listed || (!end.IsZero() && end.Before(oldest) && !c.checkpoints.ResetPending(id)) {
+			c.logger.Debug("forgetting session checkpoints", "session_id", id, "listed", listed)
+			c.checkpoints.Forget(id)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/series"
+)
+
+func TestPruneCheckpointsForgetsOldAndUnlistedSessions(t *testing.T) {
+	store, err := checkpoint.NewFileStore(filepath.Join(t.TempDir(), "watermarks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Date(2022, 9, 10, 0, 0, 0, 0, time.UTC)
+	for id := int64(1); id <= 4; id++ {
+		store.Advance(id, "device-a/1", cutoff)
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetLogger(nil)
+	c.SetCheckpointStore(store)
+	c.pruneCheckpoints(api.SessionsListResponse{
+		{ID: 1, EndTime: cutoff.Add(-8 * 24 * time.Hour)}, // ended before the retention
+		{ID: 2, EndTime: cutoff.Add(-6 * 24 * time.Hour)},
+		{ID: 3, EndTime: cutoff.Add(time.Hour)},
+		// session 4 was deleted
+	}, cutoff)
+	if got := store.Sessions(); !reflect.DeepEqual(got, []int64{2, 3}) {
+		t.Errorf("got sessions %v, want [2 3]", got)
+	}
+}
+
+// recordingSink captures submitted series, or fails every submission with err.
+type recordingSink struct {
+	submissions [][]series.Series
+	err         error
+}
+
+func (r *recordingSink) Submit(ctx context.Context, s []series.Series) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.submissions = append(r.submissions, s)
+	return nil
+}
+
+// submittedTimestamps returns the unix timestamps of every point in the last submission.
+func (r *recordingSink) submittedTimestamps() []int64 {
+	if len(r.submissions) == 0 {
+		return nil
+	}
+	var out []int64
+	for _, s := range r.submissions[len(r.submissions)-1] {
+		for _, p := range s.Points {
+			out = append(out, p.Timestamp.Unix())
+		}
+	}
+	return out
+}
+
+func TestCollectSubmitsChartWithRealTimestamps(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	old := now.Add(-3 * time.Hour)
+	client := &fakeClient{
+		sessions: api.SessionsListResponse{
+			{ID: 1, EndTime: now.Add(-2 * time.Hour)},
+			{ID: 2, EndTime: now.Add(time.Hour)},
+		},
+		charts: map[int64]api.SessionChartResponse{
+			1: {{Label: "pit", Device: "device-a", DegreeType: 2, X: []int64{old.Add(-time.Hour).Unix(), old.Unix()}, Y: []float32{32, 212}}},
+			2: {{Label: "meat", Device: "device-a", DegreeType: 1, X: []int64{now.Add(-time.Minute).Unix(), now.Unix()}, Y: []float32{60, 61}}},
+		},
+	}
+	sink := &recordingSink{}
+	c, stat := newTestCollector(client)
+	c.SetSeriesSink(sink)
+	mustCollect(t, c, old.Add(-time.Minute))
+
+	if got := stat.named("fireboard.sessions.chart"); len(got) != 0 {
+		t.Errorf("chart points were sent as gauges: %v", got)
+	}
+	if len(sink.submissions) != 1 {
+		t.Fatalf("got %d submissions, want 1", len(sink.submissions))
+	}
+	submitted := sink.submissions[0]
+	if len(submitted) != 2 {
+		t.Fatalf("got %d series, want 2: %v", len(submitted), submitted)
+	}
+	want := [][]series.Point{
+		{{Timestamp: old, Value: 100}},
+		{{Timestamp: now.Add(-time.Minute), Value: 60}, {Timestamp: now, Value: 61}},
+	}
+	for i, s := range submitted {
+		if len(s.Points) != len(want[i]) {
+			t.Errorf("series %d: got points %v, want %v", i, s.Points, want[i])
+			continue
+		}
+		for j, p := range s.Points {
+			if !p.Timestamp.Equal(want[i][j].Timestamp) || p.Value != want[i][j].Value {
+				t.Errorf("series %d point %d: got %v, want %v", i, j, p, want[i][j])
+			}
+		}
+	}
+	if got := stat.named("fireboard.collect.points_emitted"); len(got) != 1 || got[0].value != 3 {
+		t.Errorf("points emitted: got %v, want 3", got)
+	}
+}
+
+func TestCollectIngestsEachChartPointOnceAcrossRestarts(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	chart := api.SessionChartObject{Label: "pit", Device: "device-a", ChannelID: "1", X: []int64{now.Add(-2 * time.Minute).Unix(), now.Add(-time.Minute).Unix()}, Y: []float32{100, 101}}
+	client := &fakeClient{
+		sessions: api.SessionsListResponse{{ID: 1, EndTime: now.Add(time.Hour)}},
+		charts:   map[int64]api.SessionChartResponse{1: {chart}},
+	}
+	collect := func(sink *recordingSink, cutoff time.Time) []int64 {
+		t.Helper()
+		store, err := checkpoint.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, _ := newTestCollector(client)
+		c.SetSeriesSink(sink)
+		c.SetCheckpointStore(store)
+		err = c.Collect(context.Background(), cutoff, nil)
+		if err != nil && sink.err == nil {
+			t.Fatal(err)
+		}
+		return sink.submittedTimestamps()
+	}
+
+	if got := collect(&recordingSink{}, now.Add(-time.Hour)); len(got) != 2 {
+		t.Fatalf("first run: got %v, want both points", got)
+	}
+	if got := collect(&recordingSink{}, now.Add(-time.Hour)); len(got) != 0 {
+		t.Fatalf("second run: got %v, want no points", got)
+	}
+
+	chart.X = append(chart.X, now.Unix())
+	chart.Y = append(chart.Y, 102)
+	client.charts[1] = api.SessionChartResponse{chart}
+	if got := collect(&recordingSink{err: errors.New("intake unavailable")}, now.Add(-time.Hour)); len(got) != 0 {
+		t.Fatalf("failed submission: got %v", got)
+	}
+	if got := collect(&recordingSink{}, now.Add(-time.Hour)); len(got) != 1 || got[0] != now.Unix() {
+		t.Fatalf("after a failed submission: got %v, want only the new point", got)
+	}
+
+	store, err := checkpoint.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Reset(1)
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// the cutoff moved past every point, the reset session is ingested from its start
+	if got := collect(&recordingSink{}, now); len(got) != 3 {
+		t.Fatalf("after reset: got %v, want every point", got)
+	}
+	if got := collect(&recordingSink{}, now); len(got) != 0 {
+		t.Fatalf("after the reset was ingested: got %v, want no points", got)
+	}
+}
+
+func TestCollectIngestsResetSessionsAgain(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	client := &fakeClient{
+		sessions: api.SessionsListResponse{
+			{ID: 1, EndTime: now.Add(-time.Hour)}, // ended
+			{ID: 2, EndTime: now.Add(time.Hour)},
+		},
+		charts: map[int64]api.SessionChartResponse{
+			1: {{Label: "pit", Device: "device-a", ChannelID: "1", X: []int64{now.Add(-3 * time.Hour).Unix(), now.Add(-2 * time.Hour).Unix()}, Y: []float32{100, 101}}},
+			2: {{Label: "meat", Device: "device-a", ChannelID: "2", X: []int64{now.Add(-2 * time.Minute).Unix(), now.Add(-time.Minute).Unix()}, Y: []float32{60, 61}}},
+		},
+	}
+	store, err := checkpoint.NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := newTestCollector(client)
+	c.SetCheckpointStore(store)
+	collect := func(cutoff time.Time) []int64 {
+		t.Helper()
+		sink := &recordingSink{}
+		c.SetSeriesSink(sink)
+		mustCollect(t, c, cutoff)
+		return sink.submittedTimestamps()
+	}
+	if got := collect(now.Add(-4 * time.Hour)); len(got) != 4 {
+		t.Fatalf("first run: got %v, want every point", got)
+	}
+
+	// reset-watermarks runs while the collector keeps running with a cutoff past every point
+	for id := int64(1); id <= 2; id++ {
+		cli, err := checkpoint.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.Reset(id)
+		if err := cli.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := collect(now); len(got) != 0 {
+		t.Fatalf("run applying the resets: got %v, want no points", got)
+	}
+	if got := collect(now); len(got) != 4 {
+		t.Fatalf("after the resets: got %v, want every point of both sessions", got)
+	}
+	if got := collect(now); len(got) != 0 {
+		t.Fatalf("after the resets were ingested: got %v, want no points", got)
+	}
+}
@@ -1,117 +1,390 @@
 package collector
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/DataDog/datadog-go/v5/statsd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/logs"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/rules"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/series"
+)
+
+const (
+	tracerName = "github.com/platinummonkey/fireboard-datadog-integration/pkg/collector"
+
+	defaultConcurrency = 4
+	defaultItemTimeout = 30 * time.Second
+
+	// maxChartGaugeAge is how old a chart point may be to be sent as a statsd gauge, which is stamped with the time it is received
+	maxChartGaugeAge = 30 * time.Minute
+	// checkpointRetention is how long before the cutoff an ended session's watermarks and sent events are kept
+	checkpointRetention = 7 * 24 * time.Hour
 )
 
 type collector struct {
 	client api.APIClient
 	stat   statsd.ClientInterface
-	tags   []string
+	tags   TagSet
+	logger *slog.Logger
+	sink   series.Sink // submits chart points with their real timestamps, nil sends recent points as statsd gauges
+
+	checkpoints   checkpoint.Store // last ingested chart point and sent events per session, nil ingests every point after the cutoff
+	sessionEvents sentEvents       // session events sent, used without a checkpoint store
+
+	logSink         logs.Sink // receives each active device's device log, nil disables device logs
+	logRedactFields []string  // device log fields redacted before they are sent to logSink
+
+	onlineThresholds       OnlineThresholds            // default fireboard.device.online thresholds
+	deviceOnlineThresholds map[string]OnlineThresholds // fireboard.device.online thresholds by device uuid
+
+	battery   batteryTrends // recent battery samples per device for the discharge trend
+	alerts    alertStates   // state of each FireBoard channel alert
+	hashAPMAC bool          // hash the ap_mac tag of the wifi metrics
+
+	hashSecret []byte // key of the HMAC hashing network identifiers, nil drops hashed identifiers
+	processKey []byte // random key hashing the network identifiers of device snapshots without a hash secret
+
+	rulesEngine *rules.Engine // user defined temperature rules, nil disables them
+
+	temperatures   temperatureTrends  // recent realtime temperatures per channel for the rate of rise
+	channelTargets map[string]float64 // target temperatures in celsius by lower case channel label
+	rateWindow     time.Duration      // window of realtime and chart temperatures the rate of rise is estimated over
+
+	snapshots     map[string]checkpoint.DeviceSnapshot // devices seen by the previous collection, by uuid
+	snapshotStore checkpoint.SnapshotStore             // persists snapshots across restarts, nil keeps them in memory
+
+	concurrency int           // devices or sessions fetched in parallel
+	itemTimeout time.Duration // timeout for all calls made for a single device or session
+
+	clock   runClock                                                                       // time source of Run
+	collect func(ctx context.Context, cutoff time.Time, stat statsd.ClientInterface) error // a single collection of Run, Collect outside of tests
 }
 
 func NewCollector(client api.APIClient, stat statsd.ClientInterface, tags []string) *collector {
 	if client == nil {
 		client = api.NewDefaultAPIClient()
 	}
-	return &collector{
+	c := &collector{
 		client: client,
 		stat:   stat,
-		tags:   tags,
+		tags:   NewTagSet(tags...),
+		logger: slog.Default(),
+
+		concurrency: defaultConcurrency,
+		itemTimeout: defaultItemTimeout,
+
+		onlineThresholds: OnlineThresholds{}.withDefaults(),
+		rateWindow:       defaultRateWindow,
+
+		processKey: randomKey(),
+
+		clock: systemClock,
+	}
+	c.collect = c.Collect
+	return c
+}
+
+// SetConcurrency sets how many devices or sessions are fetched in parallel and the timeout for each one.
+// Parallelism is further bounded by the remaining api request budget.
+func (c *collector) SetConcurrency(workers int, itemTimeout time.Duration) {
+	if workers <= 0 {
+		workers = defaultConcurrency
 	}
+	if itemTimeout <= 0 {
+		itemTimeout = defaultItemTimeout
+	}
+	c.concurrency = workers
+	c.itemTimeout = itemTimeout
+}
+
+// workers returns the worker count, never more than the requests left in the api budget.
+func (c *collector) workers() int {
+	workers := c.concurrency
+	if remaining := c.client.GetRequestBudget().Remaining(); remaining < workers {
+		workers = remaining
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
 }
 
-func (c *collector) Authenticate(username, password string) error {
-	_, err := c.client.GetAuthToken(username, password)
+// SetSeriesSink sends session chart points after the cutoff to sink with their real timestamps instead of as statsd gauges.
+func (c *collector) SetSeriesSink(sink series.Sink) {
+	c.sink = sink
+}
+
+// SetCheckpointStore tracks the last ingested chart point per session channel in store so each point is ingested once,
+// even across restarts. Channels without a watermark fall back to the cutoff.
+func (c *collector) SetCheckpointStore(store checkpoint.Store) {
+	c.checkpoints = store
+}
+
+// SetLogger sets the structured logger, nil discards all logs.
+func (c *collector) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	c.logger = logger
+}
+
+// Authenticate obtains an API token and sends the fireboard.can_connect service check with the result.
+func (c *collector) Authenticate(ctx context.Context, username, password string) error {
+	_, err := c.client.GetAuthToken(ctx, username, password)
+	if err != nil {
+		c.logger.Error("fireboard authentication failed", "error", err)
+	}
+	c.emitCanConnect(err, true, c.stat)
 	return err
 }
 
-func (c *collector) Collect(cutoffDate time.Time, stat statsd.ClientInterface) error {
-	devices, err := c.client.ListDevices()
+// Collect runs a single collection, it is traced as a root span with a child span per device and session.
+// Devices and sessions are fetched in parallel, their metrics are emitted in list order once all are done.
+// Metrics are sent to stat, or the collector's statsd client if stat is nil.
+// A device or session that fails is counted in fireboard.collect.failed_items and logged but does not fail the
+// collection, only listing the devices or sessions, submitting the chart series or saving the watermarks does.
+func (c *collector) Collect(ctx context.Context, cutoffDate time.Time, stat statsd.ClientInterface) (err error) {
+	if stat == nil {
+		stat = c.stat
+	}
+	tracer := otel.Tracer(tracerName)
+	ctx, span := tracer.Start(ctx, "fireboard.collect", trace.WithNewRoot())
+	start := time.Now()
+	var devicesProcessed, pointsEmitted atomic.Int64
+	failedItems := 0
+	defer func() {
+		statusTag := "status:ok"
+		if err != nil {
+			statusTag = "status:error"
+		} else if failedItems > 0 {
+			statusTag = "status:partial"
+		}
+		stat.Distribution("fireboard.collect.duration", time.Since(start).Seconds(), c.tags.With(statusTag).Tags(), 1.0)
+		stat.Count("fireboard.collect.devices_processed", devicesProcessed.Load(), c.tags.Tags(), 1.0)
+		stat.Count("fireboard.collect.points_emitted", pointsEmitted.Load(), c.tags.Tags(), 1.0)
+		endSpan(span, err)
+	}()
+
+	devices, err := c.client.ListDevices(ctx)
+	// a missing or expired token is found before any request is sent, Run re-authenticates and reports that instead
+	if !errors.Is(err, api.ErrNoValidToken) && !errors.Is(err, api.ErrExpiredToken) {
+		c.emitCanConnect(err, false, stat)
+	}
 	if err != nil {
-		c.stat.Incr("fireboard.devices.errors", append(c.tags, "func:devicesList"), 1.0)
+		stat.Incr("fireboard.devices.errors", c.tags.With("func:devicesList").Tags(), 1.0)
+		c.logger.Error("unable to list devices", "func", "devicesList", "error", err)
 		return err
 	}
-	c.stat.Count("fireboard.devices", int64(len(devices)), c.tags, 1)
-	for _, device := range devices {
-		if device.Active {
-			uuidTag := "uuid:" + device.UUID
-			tags := append(c.tags, uuidTag)
-			c.stat.Incr("fireboard.devices.active", tags, 1.0)
-			c.stat.Gauge("fireboard.devices.link_quality", device.DeviceLog.LinkQualityPercent(), append(tags, "ssid:"+device.DeviceLog.SSID), 1.0)
-			c.stat.Gauge("fireboard.devices.disk_usage_percent", device.DeviceLog.DiskUsagePercent(), tags, 1.0)
-			c.stat.Gauge("fireboard.devices.memory_usage_percent", device.DeviceLog.MemoryUsagePercent(), tags, 1.0)
-			c.stat.Gauge("fireboard.devices.cpu_usage_percent", device.DeviceLog.CPUPercent(), tags, 1.0)
-			/*
-				driveData, err := c.client.GetRealTimeDeviceDriveData(device.UUID)
-				if err != nil {
-					c.stat.Incr("fireboard.devices.errors", append(c.tags, uuidTag, "func:devicesGetRealtimeDeviceDriveData"), 1.0)
-					return err
+	stat.Count("fireboard.devices", int64(len(devices)), c.tags.Tags(), 1)
+	deviceStats := make([]*bufferedStat, len(devices))
+	deviceLogs := make([]*logs.Record, len(devices))
+	deviceErrs := runBounded(ctx, len(devices), c.workers(), c.itemTimeout, func(ctx context.Context, i int) error {
+		deviceStats[i] = newBufferedStat(stat)
+		processed, err := c.collectDevice(ctx, devices[i], deviceStats[i])
+		if processed {
+			devicesProcessed.Add(1)
+			if c.logSink != nil {
+				if record, ok := c.deviceLogRecord(devices[i], c.tags.With("uuid:"+devices[i].UUID)); ok {
+					deviceLogs[i] = &record
 				}
-				// TODO: report drive data
-
-				tempData, err := c.client.GetRealTimeDeviceTemperature(device.UUID)
-				if err != nil {
-					c.stat.Incr("fireboard.devices.errors", append(c.tags, uuidTag, "func:devicesGetRealtimeTemperatureData"), 1.0)
-					return err
-				}
-				// TODO: report temp data
-			*/
+			}
 		}
-		// do something with cutoff date
+		return err
+	})
+	flushAll(deviceStats)
+	failedItems += c.reportItemErrors("device", deviceErrs, stat)
+	c.temperatures.evict(time.Now().Add(-c.rateWindow))
+	c.detectDeviceChanges(devices, stat)
+	if c.logSink != nil {
+		c.sendDeviceLogs(ctx, deviceLogs, stat)
 	}
 
-	sessions, err := c.client.ListAllSessions()
-	c.stat.Count("fireboard.sessions", int64(len(sessions)), c.tags, 1.0)
+	sessions, err := c.client.ListAllSessions(ctx)
+	stat.Count("fireboard.sessions", int64(len(sessions)), c.tags.Tags(), 1.0)
 	if err != nil {
-		c.stat.Incr("fireboard.sessions.errors", append(c.tags, "func:sessionsList"), 1.0)
+		stat.Incr("fireboard.sessions.errors", c.tags.With("func:sessionsList").Tags(), 1.0)
+		c.logger.Error("unable to list sessions", "func", "sessionsList", "error", err)
 		return err
 	}
-	for _, session := range sessions {
-		active := session.EndTime.After()
-		sessionIDTag := fmt.Sprintf("sessionID:%d", session.ID)
-		tags := append(c.tags, sessionIDTag)
-		if active {
-			c.stat.Incr("fireboard.sessions.active", tags, 1.0)
+	c.pruneCheckpoints(sessions, cutoffDate)
+	channels := channelsByLabel(devices)
+	sessionStats := make([]*bufferedStat, len(sessions))
+	sessionCharts := make([][]sessionChart, len(sessions))
+	sessionErrs := runBounded(ctx, len(sessions), c.workers(), c.itemTimeout, func(ctx context.Context, i int) error {
+		sessionStats[i] = newBufferedStat(stat)
+		chart, err := c.collectSession(ctx, sessions[i], cutoffDate, channels, sessionStats[i])
+		if c.sink == nil {
+			pointsEmitted.Add(int64(emitRecentChart(chart, sessionStats[i])))
 		}
-		if session.EndTime.After(cutoffDate) {
-			// do something with
-			chartDataForSession, err := c.client.GetSessionChartData(session.ID)
-			if err != nil {
-				c.stat.Incr("fireboard.devices.errors", append(tags, "func:sessionsGetChartData"), 1.0)
-				return err
-			}
-			// TODO report chart data
-			for _, sensor := range chartDataForSession {
-				sensorTags := append(tags, "label:" + sensor.Label, "device_id:" + sensor.Device)
-				conversion := unity
-				if sensor.DegreeType == 2 {
-					conversion = fToC
-				}
-				// fixme for non temp sensors ^^^
-				for i := 0; i < len(sensor.X); i++ {
-					d := time.Unix(sensor.X[i], 0)
-					if d.After(time.Now().Add(time.Minute * -30)) {
-						// ignore all other data it's too old to ingest
-						v := sensor.Y[1]
-						c.stat.Gauge("fireboard.sessions.chart", conversion(v))
-					}
-				}
-			}
+		sessionCharts[i] = chart
+		return err
+	})
+	flushAll(sessionStats)
+	failedItems += c.reportItemErrors("session", sessionErrs, stat)
+	var charts []sessionChart
+	for _, chart := range sessionCharts {
+		charts = append(charts, chart...)
+	}
+	if c.sink != nil {
+		points, err := c.submitCharts(ctx, charts, stat)
+		pointsEmitted.Add(int64(points))
+		if err != nil {
+			return err
 		}
 	}
+	if err := c.advanceWatermarks(charts, stat); err != nil {
+		return err
+	}
+
+	c.logger.Debug("collection complete", "devices", len(devices), "sessions", len(sessions), "failed_items", failedItems)
+	return nil
 }
 
+// reportItemErrors counts the devices or sessions, by kind, that failed in fireboard.collect.failed_items and returns
+// the count. The failures themselves are logged and counted where they happen.
+func (c *collector) reportItemErrors(kind string, errs []error, stat statsd.ClientInterface) int {
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		stat.Count("fireboard.collect.failed_items", int64(failed), c.tags.With("kind:"+kind).Tags(), 1.0)
+		c.logger.Warn("collection items failed", "kind", kind, "failed", failed, "total", len(errs), "error", errors.Join(errs...))
+	}
+	return failed
+}
+
+// collectDevice emits the metrics for a single device, it returns true if the device was active. A failed call is
+// recorded in the returned error and the calls that do not depend on it are still made.
+func (c *collector) collectDevice(ctx context.Context, device api.DevicePropertiesResponse, stat statsd.ClientInterface) (_ bool, err error) {
+	c.logger.Debug("collecting device", "device_uuid", device.UUID, "active", device.Active)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "fireboard.collect.device", trace.WithAttributes(
+		attribute.String("fireboard.device_uuid", device.UUID),
+		attribute.Bool("fireboard.device_active", device.Active),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+	uuidTag := "uuid:" + device.UUID
+	tags := c.tags.With(uuidTag)
+	c.emitDeviceInfo(device, tags, stat)
+	if !device.Active {
+		return false, nil
+	}
+
+	stat.Incr("fireboard.devices.active", tags.Tags(), 1.0)
+	stat.Gauge("fireboard.devices.link_quality", device.DeviceLog.LinkQualityPercent(), tags.With("ssid:"+device.DeviceLog.SSID).Tags(), 1.0)
+	stat.Gauge("fireboard.devices.disk_usage_percent", device.DeviceLog.DiskUsagePercent(), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.devices.memory_usage_percent", device.DeviceLog.MemoryUsagePercent(), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.devices.cpu_usage_percent", device.DeviceLog.CPUPercent(), tags.Tags(), 1.0)
+	c.emitDeviceOnline(device, tags, stat)
+	c.emitBattery(device, tags, stat)
+	c.emitHardware(device, tags, stat)
+	// a failed drive call is reported with the device's result, the temperatures do not depend on it
+	var driveErr error
+	if hasDrive(device) {
+		c.emitDrive(device, device.LastDriveLog, driveSourceLast, tags, stat)
+		driveData, err := c.client.GetRealTimeDeviceDriveData(ctx, device.UUID)
+		if err != nil {
+			stat.Incr("fireboard.devices.errors", tags.With("func:devicesGetRealtimeDeviceDriveData").Tags(), 1.0)
+			c.logger.Error("unable to get realtime drive data", "func", "devicesGetRealtimeDeviceDriveData", "device_uuid", device.UUID, "error", err)
+			driveErr = err
+		} else {
+			c.emitDrive(device, *driveData, driveSourceRealtime, tags, stat)
+		}
+	}
+
+	temps, err := c.client.GetRealTimeDeviceTemperature(ctx, device.UUID)
+	if err != nil {
+		stat.Incr("fireboard.devices.errors", tags.With("func:devicesGetRealtimeTemperatureData").Tags(), 1.0)
+		c.logger.Error("unable to get realtime temperatures", "func", "devicesGetRealtimeTemperatureData", "device_uuid", device.UUID, "error", err)
+		return true, errors.Join(driveErr, err)
+	}
+	c.emitTemperatures(device, temps, tags, stat)
+	now := time.Now()
+	c.evaluateAlerts(device, temps, tags, now, stat)
+	c.evaluateRules(ctx, device, temps, tags, now, stat)
+	c.emitChannelTrends(device, temps, tags, now, stat)
+	// do something with cutoff date
+	return true, driveErr
+}
+
+// collectSession emits the metrics for a single session and returns its chart points that have not been ingested.
+// The chart points of an active session also seed the temperature trends of the device channels by label.
+func (c *collector) collectSession(ctx context.Context, session api.SessionListResponse, cutoffDate time.Time, channels map[string]map[string]int64, stat statsd.ClientInterface) (chart []sessionChart, err error) {
+	active := session.EndTime.After(time.Now())
+	sessionIDTag := fmt.Sprintf("sessionID:%d", session.ID)
+	tags := c.tags.With(sessionIDTag)
+	if active {
+		stat.Incr("fireboard.sessions.active", tags.Tags(), 1.0)
+	}
+	c.logger.Debug("collecting session", "session_id", session.ID, "active", active)
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "fireboard.collect.session", trace.WithAttributes(
+		attribute.Int64("fireboard.session_id", session.ID),
+		attribute.Bool("fireboard.session_active", active),
+	))
+	defer func() {
+		endSpan(span, err)
+	}()
+	// a reset session is ingested again from its start, even once it ended
+	since := cutoffDate
+	if c.checkpoints != nil && c.checkpoints.ResetPending(session.ID) {
+		since = time.Time{}
+	}
+	if !session.EndTime.After(since) {
+		return nil, nil
+	}
+
+	chartDataForSession, err := c.client.GetSessionChartData(ctx, session.ID)
+	if err != nil {
+		stat.Incr("fireboard.devices.errors", tags.With("func:sessionsGetChartData").Tags(), 1.0)
+		c.logger.Error("unable to get session chart data", "func", "sessionsGetChartData", "session_id", session.ID, "error", err)
+		return nil, err
+	}
+	if active {
+		c.seedChannelTrends(chartDataForSession, channels, time.Now())
+	}
+	c.emitSessionEvents(session, chartDataForSession, cutoffDate, time.Now(), tags, stat)
+	return c.pendingChart(session.ID, chartDataForSession, since, tags), nil
+}
+
+// flushAll flushes the buffered emissions in order, skipping items that never ran.
+func flushAll(stats []*bufferedStat) {
+	for _, s := range stats {
+		if s != nil {
+			s.flush()
+		}
+	}
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
 
 func unity(v float32) float32 {
 	return v
 }
 
 func fToC(v float32) float32 {
-	return (v - 32) * 5.0/9.0
-}
\ No newline at end of file
+	return (v - 32) * 5.0 / 9.0
+}
@@ -0,0 +1,431 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// metric is a single emission captured by recordingStat.
+type metric struct {
+	name  string
+	value float64
+	tags  []string
+}
+
+func (m metric) hasTag(tag string) bool {
+	for _, t := range m.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (m metric) tagWithPrefix(prefix string) []string {
+	var out []string
+	for _, t := range m.tags {
+		if strings.HasPrefix(t, prefix) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// recordingStat captures gauges, counts, increments, distributions, events and service checks.
+type recordingStat struct {
+	statsd.NoOpClient
+	metrics []metric
+	events  []*statsd.Event
+	checks  []*statsd.ServiceCheck
+	mu      sync.Mutex
+}
+
+func (r *recordingStat) ServiceCheck(sc *statsd.ServiceCheck) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, sc)
+	return nil
+}
+
+func (r *recordingStat) namedChecks(name string) []*statsd.ServiceCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*statsd.ServiceCheck
+	for _, sc := range r.checks {
+		if sc.Name == name {
+			out = append(out, sc)
+		}
+	}
+	return out
+}
+
+func (r *recordingStat) Event(e *statsd.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recordingStat) add(name string, value float64, tags []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, metric{name: name, value: value, tags: tags})
+	return nil
+}
+
+func (r *recordingStat) Gauge(name string, value float64, tags []string, _ float64) error {
+	return r.add(name, value, tags)
+}
+
+func (r *recordingStat) Count(name string, value int64, tags []string, _ float64) error {
+	return r.add(name, float64(value), tags)
+}
+
+func (r *recordingStat) Incr(name string, tags []string, _ float64) error {
+	return r.add(name, 1, tags)
+}
+
+func (r *recordingStat) Distribution(name string, value float64, tags []string, _ float64) error {
+	return r.add(name, value, tags)
+}
+
+func (r *recordingStat) named(name string) []metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []metric
+	for _, m := range r.metrics {
+		if m.name == name {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// fakeClient serves canned responses, unset methods panic. fail injects errors by "method" or "method/id".
+type fakeClient struct {
+	api.APIClient
+	devices  api.ListDevicesResponse
+	sessions api.SessionsListResponse
+	charts   map[int64]api.SessionChartResponse
+	temps    map[string]api.RealTimeTemperatureResponse
+	drives   map[string]api.DriveLogResponse
+	fail     map[string]error
+	budget   *api.RequestBudget
+	auths    int // GetAuthToken calls
+}
+
+func (f *fakeClient) err(method string, id interface{}) error {
+	if err, ok := f.fail[method]; ok {
+		return err
+	}
+	return f.fail[fmt.Sprintf("%s/%v", method, id)]
+}
+
+func (f *fakeClient) GetRequestBudget() *api.RequestBudget {
+	if f.budget != nil {
+		return f.budget
+	}
+	return api.NewRequestBudget(0)
+}
+
+func (f *fakeClient) GetAuthToken(ctx context.Context, username, password string) (string, error) {
+	f.auths++
+	if err := f.err("GetAuthToken", ""); err != nil {
+		return "", err
+	}
+	return "token", nil
+}
+
+func (f *fakeClient) ListDevices(ctx context.Context) (api.ListDevicesResponse, error) {
+	if err := f.err("ListDevices", ""); err != nil {
+		return nil, err
+	}
+	return f.devices, nil
+}
+
+func (f *fakeClient) ListAllSessions(ctx context.Context) (api.SessionsListResponse, error) {
+	if err := f.err("ListAllSessions", ""); err != nil {
+		return nil, err
+	}
+	return f.sessions, nil
+}
+
+func (f *fakeClient) GetRealTimeDeviceTemperature(ctx context.Context, deviceUUID string) (api.RealTimeTemperatureResponse, error) {
+	if err := f.err("GetRealTimeDeviceTemperature", deviceUUID); err != nil {
+		return nil, err
+	}
+	return f.temps[deviceUUID], nil
+}
+
+func (f *fakeClient) GetRealTimeDeviceDriveData(ctx context.Context, deviceUUID string) (*api.DriveLogResponse, error) {
+	if err := f.err("GetRealTimeDeviceDriveData", deviceUUID); err != nil {
+		return nil, err
+	}
+	drive := f.drives[deviceUUID]
+	return &drive, nil
+}
+
+func (f *fakeClient) GetSessionChartData(ctx context.Context, sessionID int64) (api.SessionChartResponse, error) {
+	if err := f.err("GetSessionChartData", sessionID); err != nil {
+		return nil, err
+	}
+	return f.charts[sessionID], nil
+}
+
+// newTestCollector returns a collector for client with tags, discarding its logs and emitting to the returned stat.
+func newTestCollector(client *fakeClient, tags ...string) (*collector, *recordingStat) {
+	stat := &recordingStat{}
+	c := NewCollector(client, stat, tags)
+	c.SetLogger(nil)
+	return c, stat
+}
+
+// mustCollect runs a single collection with cutoff, failing the test on error.
+func mustCollect(t *testing.T, c *collector, cutoff time.Time) {
+	t.Helper()
+	if err := c.Collect(context.Background(), cutoff, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectTagsDoNotBleedAcrossDevicesAndSessions(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{
+			{UUID: "device-a", Active: true, DeviceLog: api.DeviceLog{SSID: "ssid-a"}},
+			{UUID: "device-b", Active: true, DeviceLog: api.DeviceLog{SSID: "ssid-b"}},
+			{UUID: "device-c", Active: true, DeviceLog: api.DeviceLog{SSID: "ssid-c"}},
+		},
+		sessions: api.SessionsListResponse{
+			{ID: 1, EndTime: now.Add(time.Hour)},
+			{ID: 2, EndTime: now.Add(time.Hour)},
+		},
+		charts: map[int64]api.SessionChartResponse{
+			1: {
+				{Label: "pit", Device: "device-a", X: []int64{now.Unix()}, Y: []float32{225, 226}},
+				{Label: "meat", Device: "device-a", X: []int64{now.Unix()}, Y: []float32{150, 151}},
+			},
+			2: {
+				{Label: "ambient", Device: "device-b", X: []int64{now.Unix()}, Y: []float32{70, 71}},
+			},
+		},
+	}
+	// extra capacity in the base tags used to let appends overwrite each other
+	baseTags := make([]string, 1, 16)
+	baseTags[0] = "env:test"
+
+	stat := &recordingStat{}
+	c := NewCollector(client, stat, baseTags)
+	c.SetLogger(nil)
+	c.SetConcurrency(3, time.Second)
+	mustCollect(t, c, now.Add(-time.Hour))
+
+	for _, name := range []string{"fireboard.devices.active", "fireboard.devices.cpu_usage_percent", "fireboard.devices.link_quality"} {
+		metrics := stat.named(name)
+		if len(metrics) != 3 {
+			t.Fatalf("%s: got %d metrics, want 3", name, len(metrics))
+		}
+		var uuids []string
+		for _, m := range metrics {
+			uuid := m.tagWithPrefix("uuid:")
+			if len(uuid) != 1 {
+				t.Errorf("%s: want exactly one uuid tag, got %v", name, m.tags)
+				continue
+			}
+			uuids = append(uuids, uuid[0])
+			if !m.hasTag("env:test") {
+				t.Errorf("%s: missing base tag in %v", name, m.tags)
+			}
+			if ssid := m.tagWithPrefix("ssid:"); name != "fireboard.devices.link_quality" && len(ssid) > 0 {
+				t.Errorf("%s: ssid tag leaked: %v", name, m.tags)
+			}
+		}
+		sort.Strings(uuids)
+		if strings.Join(uuids, ",") != "uuid:device-a,uuid:device-b,uuid:device-c" {
+			t.Errorf("%s: got uuids %v", name, uuids)
+		}
+	}
+
+	for _, m := range stat.named("fireboard.devices.link_quality") {
+		uuid := strings.TrimPrefix(m.tagWithPrefix("uuid:")[0], "uuid:")
+		ssid := m.tagWithPrefix("ssid:")
+		if len(ssid) != 1 || ssid[0] != "ssid:ssid-"+strings.TrimPrefix(uuid, "device-") {
+			t.Errorf("link quality for %s has ssid tags %v", uuid, ssid)
+		}
+	}
+
+	charts := stat.named("fireboard.sessions.chart")
+	if len(charts) != 3 {
+		t.Fatalf("got %d chart points, want 3", len(charts))
+	}
+	for _, m := range charts {
+		labels := m.tagWithPrefix("label:")
+		sessions := m.tagWithPrefix("sessionID:")
+		if len(labels) != 1 || len(sessions) != 1 {
+			t.Errorf("chart point has tags %v", m.tags)
+			continue
+		}
+		if labels[0] == "label:ambient" && sessions[0] != "sessionID:2" ||
+			labels[0] != "label:ambient" && sessions[0] != "sessionID:1" {
+			t.Errorf("chart point label and session mismatch: %v", m.tags)
+		}
+		if len(m.tagWithPrefix("uuid:")) != 0 {
+			t.Errorf("device tag leaked into session metric: %v", m.tags)
+		}
+	}
+	for _, m := range stat.named("fireboard.devices") {
+		if len(m.tags) != 1 {
+			t.Errorf("base tags were modified: %v", m.tags)
+		}
+	}
+}
+
+func TestCollectUsesStatArgument(t *testing.T) {
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{{UUID: "device-a", Active: true}},
+	}
+	constructed := &recordingStat{}
+	passed := &recordingStat{}
+	c := NewCollector(client, constructed, nil)
+	c.SetLogger(nil)
+	if err := c.Collect(context.Background(), time.Now(), passed); err != nil {
+		t.Fatal(err)
+	}
+	if len(constructed.metrics) != 0 {
+		t.Errorf("metrics were sent to the collector's client: %v", constructed.metrics)
+	}
+	if len(passed.named("fireboard.devices.active")) != 1 {
+		t.Errorf("metrics were not sent to the stat argument: %v", passed.metrics)
+	}
+}
+
+func TestCollectErrorPaths(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		fail        string
+		wantErr     bool
+		wantMetric  string // error counter emitted with wantFunc
+		wantFunc    string
+		wantFailed  string // kind of the failed item, if any
+		wantDevices int    // devices reported active
+		wantTemps   int    // temperatures emitted
+	}{
+		{"ListDevices", true, "fireboard.devices.errors", "func:devicesList", "", 0, 0},
+		{"GetRealTimeDeviceTemperature/device-a", false, "fireboard.devices.errors", "func:devicesGetRealtimeTemperatureData", "kind:device", 2, 1},
+		{"ListAllSessions", true, "fireboard.sessions.errors", "func:sessionsList", "", 2, 2},
+		{"GetSessionChartData/1", false, "fireboard.devices.errors", "func:sessionsGetChartData", "kind:session", 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fail, func(t *testing.T) {
+			client := &fakeClient{
+				devices:  api.ListDevicesResponse{{UUID: "device-a", Active: true}, {UUID: "device-b", Active: true}},
+				sessions: api.SessionsListResponse{{ID: 1, EndTime: now.Add(time.Hour)}},
+				temps: map[string]api.RealTimeTemperatureResponse{
+					"device-a": {{Channel: 1, Temp: 225, DegreeType: 2, Created: now}},
+					"device-b": {{Channel: 1, Temp: 150, DegreeType: 2, Created: now}},
+				},
+				fail: map[string]error{tt.fail: errors.New("boom")},
+			}
+			c, stat := newTestCollector(client)
+			if err := c.Collect(context.Background(), now.Add(-time.Hour), nil); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want an error: %v", err, tt.wantErr)
+			}
+			if errs := stat.named(tt.wantMetric); len(errs) != 1 || !errs[0].hasTag(tt.wantFunc) {
+				t.Errorf("got %s %v, want one tagged %s", tt.wantMetric, errs, tt.wantFunc)
+			}
+			failed := stat.named("fireboard.collect.failed_items")
+			if tt.wantFailed == "" && len(failed) != 0 || tt.wantFailed != "" && (len(failed) != 1 || !failed[0].hasTag(tt.wantFailed)) {
+				t.Errorf("got failed items %v, want %q", failed, tt.wantFailed)
+			}
+			if got := len(stat.named("fireboard.devices.active")); got != tt.wantDevices {
+				t.Errorf("got %d active devices, want %d", got, tt.wantDevices)
+			}
+			if got := len(stat.named("fireboard.channel.temperature")); got != tt.wantTemps {
+				t.Errorf("got %d temperatures, want %d", got, tt.wantTemps)
+			}
+			status := stat.named("fireboard.collect.duration")
+			want := map[bool]string{true: "status:error", false: "status:partial"}[tt.wantErr]
+			if len(status) != 1 || !status[0].hasTag(want) {
+				t.Errorf("got duration %v, want %s", status, want)
+			}
+		})
+	}
+}
+
+func TestCollectTracesDevicesAndSessions(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	now := time.Now()
+	client := &fakeClient{
+		devices:  api.ListDevicesResponse{{UUID: "device-a", Active: true}, {UUID: "device-b"}},
+		sessions: api.SessionsListResponse{{ID: 1, EndTime: now.Add(time.Hour)}},
+		fail:     map[string]error{"GetSessionChartData/1": errors.New("boom")},
+	}
+	c := NewCollector(client, &recordingStat{}, nil)
+	c.SetLogger(nil)
+	// a parent span in the context must not become the parent of the run
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	if err := c.Collect(ctx, now.Add(-time.Hour), nil); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+	root := spans["fireboard.collect"]
+	if len(root) != 1 || root[0].Parent().IsValid() {
+		t.Fatalf("got %d collect spans, want a single root span", len(root))
+	}
+	devices, sessions := spans["fireboard.collect.device"], spans["fireboard.collect.session"]
+	if len(devices) != 2 || len(sessions) != 1 {
+		t.Fatalf("got %d device and %d session spans, want 2 and 1", len(devices), len(sessions))
+	}
+	for _, span := range append(devices, sessions...) {
+		if span.Parent().SpanID() != root[0].SpanContext().SpanID() {
+			t.Errorf("%s is not a child of the collect span", span.Name())
+		}
+	}
+	if sessions[0].Status().Code != codes.Error {
+		t.Errorf("failed session span status: got %v", sessions[0].Status())
+	}
+}
+
+func TestAuthenticateLogsFailureWithoutUsername(t *testing.T) {
+	client := &fakeClient{fail: map[string]error{"GetAuthToken": errors.New("bad credentials")}}
+	c := NewCollector(client, &recordingStat{}, nil)
+	var out bytes.Buffer
+	c.SetLogger(slog.New(slog.NewTextHandler(&out, nil)))
+	if err := c.Authenticate(context.Background(), "pitmaster@example.com", "hunter2"); err == nil {
+		t.Fatal("expected an error")
+	}
+	logged := out.String()
+	if !strings.Contains(logged, "fireboard authentication failed") || !strings.Contains(logged, "bad credentials") {
+		t.Errorf("the injected logger did not receive the failure: %s", logged)
+	}
+	for _, secret := range []string{"pitmaster", "hunter2"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("logs contain %q: %s", secret, logged)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/logs"
+)
+
+// SetLogSink sends each active device's device log to sink as a structured log after every collection, with the
+// values of the redactFields device log fields replaced.
+func (c *collector) SetLogSink(sink logs.Sink, redactFields []string) {
+	c.logSink = sink
+	c.logRedactFields = redactFields
+}
+
+// deviceLogRecord returns the device's log as a structured log record, false if the device has not reported one.
+func (c *collector) deviceLogRecord(device api.DevicePropertiesResponse, tags TagSet) (logs.Record, bool) {
+	if device.DeviceLog.Date.IsZero() {
+		return logs.Record{}, false
+	}
+	data, err := json.Marshal(device.DeviceLog)
+	if err != nil {
+		c.logger.Warn("unable to encode device log", "device_uuid", device.UUID, "error", err)
+		return logs.Record{}, false
+	}
+	var deviceLog map[string]interface{}
+	if err := json.Unmarshal(data, &deviceLog); err != nil {
+		c.logger.Warn("unable to encode device log", "device_uuid", device.UUID, "error", err)
+		return logs.Record{}, false
+	}
+	return logs.Record{
+		Timestamp: device.DeviceLog.Date,
+		Message:   "FireBoard device log for " + device.Title,
+		Tags:      tags.Tags(),
+		Attributes: map[string]interface{}{
+			"device_uuid":  device.UUID,
+			"device_title": device.Title,
+			"device_log":   logs.Redact(deviceLog, c.logRedactFields),
+		},
+	}, true
+}
+
+// sendDeviceLogs sends the device log records to the log sink. Failures are logged and counted but do not fail the
+// collection, the next collection sends fresh snapshots.
+func (c *collector) sendDeviceLogs(ctx context.Context, records []*logs.Record, stat statsd.ClientInterface) {
+	var batch []logs.Record
+	for _, r := range records {
+		if r != nil {
+			batch = append(batch, *r)
+		}
+	}
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.itemTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := c.logSink.Send(ctx, batch); err != nil {
+		stat.Incr("fireboard.devices.errors", c.tags.With("func:logsSend").Tags(), 1.0)
+		c.logger.Error("unable to send device logs", "func", "logsSend", "records", len(batch), "error", err)
+		return
+	}
+	c.logger.Debug("sent device logs", "records", len(batch), "duration", time.Since(start))
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/logs"
+)
+
+func TestCollectSendsRedactedDeviceLogs(t *testing.T) {
+	date := time.Date(2022, 9, 1, 0, 36, 11, 0, time.UTC)
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{
+			{UUID: "device-a", Title: "Smoker", Active: true, DeviceLog: api.DeviceLog{Date: date, SSID: "home", PublicIP: "8.8.8.8", BoardID: "GCMABCD12"}},
+			{UUID: "device-b", Active: true},
+			{UUID: "device-c", DeviceLog: api.DeviceLog{Date: date}},
+		},
+	}
+	var out bytes.Buffer
+	c, _ := newTestCollector(client)
+	c.SetLogSink(logs.NewWriterSink(&out), []string{"ssid", "publicIP"})
+	mustCollect(t, c, time.Now())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d logs, want 1 for the only active device with a device log:\n%s", len(lines), out.String())
+	}
+	var got struct {
+		Timestamp  string                 `json:"timestamp"`
+		Tags       string                 `json:"ddtags"`
+		DeviceUUID string                 `json:"device_uuid"`
+		DeviceLog  map[string]interface{} `json:"device_log"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.DeviceUUID != "device-a" || got.Timestamp != "2022-09-01T00:36:11Z" || got.Tags != "uuid:device-a" {
+		t.Errorf("got %+v", got)
+	}
+	if got.DeviceLog["ssid"] != "REDACTED" || got.DeviceLog["publicIP"] != "REDACTED" || got.DeviceLog["boardID"] != "GCMABCD12" {
+		t.Errorf("device log redaction: %v", got.DeviceLog)
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const (
+	driveSourceRealtime = "drive_source:realtime"
+	driveSourceLast     = "drive_source:last_drivelog"
+)
+
+// hasDrive returns true if the device has ever reported a FireBoard Drive log.
+// Only these devices are polled on the drivelog endpoint, the rest would spend the request budget on empty logs.
+func hasDrive(device api.DevicePropertiesResponse) bool {
+	return !device.LastDriveLog.Created.IsZero()
+}
+
+// boolGauge returns 1 for true and 0 for false.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// emitDrive emits the fireboard.drive metrics for a drive log, the drive_source tag tells the realtime endpoint and the
+// device's last drive log apart. Logs with a zero Created time are empty and skipped.
+func (c *collector) emitDrive(device api.DevicePropertiesResponse, drive api.DriveLogResponse, source string, tags TagSet, stat statsd.ClientInterface) {
+	if drive.Created.IsZero() {
+		c.logger.Debug("skipping empty drive log", "device_uuid", device.UUID, "source", source)
+		return
+	}
+	conversion := unity
+	if drive.DegreeType == 2 {
+		conversion = fToC
+	}
+	mode := strings.ToLower(drive.ModeType)
+	if mode == "" {
+		mode = "unknown"
+	}
+	powerMode := drive.PowerMode
+	if powerMode == "" {
+		powerMode = "unknown"
+	}
+	tags = tags.With(source, fmt.Sprintf("channel:%d", drive.TiedChannel), "mode:"+mode)
+	stat.Gauge("fireboard.drive.percent", float64(drive.DrivePercent)*100, tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.setpoint", float64(conversion(drive.SetPoint)), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.tied_channel", float64(drive.TiedChannel), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.mode_on", boolGauge(mode == "on"), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.lid_paused", boolGauge(drive.LidPaused), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.user_initiated", boolGauge(drive.UserInitiated), tags.Tags(), 1.0)
+	stat.Gauge("fireboard.drive.power_mode", 1, tags.With("power_mode:"+powerMode).Tags(), 1.0)
+}
@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestCollectEmitsDriveFromRealtimeAndLastDriveLog(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{
+			{
+				UUID:   "device-a",
+				Active: true,
+				LastDriveLog: api.DriveLogResponse{
+					ModeType: "Off", TiedChannel: 1, SetPoint: 212, DegreeType: 2,
+					Created: now.Add(-time.Hour), PowerMode: "Battery",
+				},
+			},
+			{UUID: "device-b", Active: true},
+		},
+		drives: map[string]api.DriveLogResponse{
+			"device-a": {
+				ModeType: "On", TiedChannel: 1, DrivePercent: 0.42, SetPoint: 225, DegreeType: 1,
+				Created: now, UserInitiated: true, LidPaused: true, PowerMode: "Mains",
+			},
+		},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, now)
+
+	bySource := func(name string) map[string]metric {
+		out := map[string]metric{}
+		for _, m := range stat.named(name) {
+			if !m.hasTag("uuid:device-a") {
+				t.Errorf("%s: unexpected tags %v", name, m.tags)
+			}
+			source := m.tagWithPrefix("drive_source:")
+			if len(source) != 1 {
+				t.Fatalf("%s: want one drive_source tag, got %v", name, m.tags)
+			}
+			out[source[0]] = m
+		}
+		return out
+	}
+
+	setpoints := bySource("fireboard.drive.setpoint")
+	if len(setpoints) != 2 {
+		t.Fatalf("got setpoints %v, want one per source", setpoints)
+	}
+	if v := setpoints["drive_source:last_drivelog"].value; v != 100 {
+		t.Errorf("last drive log setpoint: got %v, want 100", v)
+	}
+	if v := setpoints["drive_source:realtime"].value; v != 225 {
+		t.Errorf("realtime setpoint: got %v, want 225", v)
+	}
+
+	realtime := map[string]float64{
+		"fireboard.drive.percent":        42,
+		"fireboard.drive.tied_channel":   1,
+		"fireboard.drive.mode_on":        1,
+		"fireboard.drive.lid_paused":     1,
+		"fireboard.drive.user_initiated": 1,
+	}
+	for name, want := range realtime {
+		m, ok := bySource(name)["drive_source:realtime"]
+		if !ok {
+			t.Errorf("%s: not emitted", name)
+			continue
+		}
+		if diff := m.value - want; diff > 1e-4 || diff < -1e-4 {
+			t.Errorf("%s: got %v, want %v", name, m.value, want)
+		}
+		if !m.hasTag("channel:1") || !m.hasTag("mode:on") {
+			t.Errorf("%s: missing channel or mode tag in %v", name, m.tags)
+		}
+	}
+	if m := bySource("fireboard.drive.mode_on")["drive_source:last_drivelog"]; m.value != 0 {
+		t.Errorf("last drive log mode_on: got %v, want 0", m.value)
+	}
+	power := bySource("fireboard.drive.power_mode")
+	if !power["drive_source:realtime"].hasTag("power_mode:Mains") || !power["drive_source:last_drivelog"].hasTag("power_mode:Battery") {
+		t.Errorf("power mode tags: %v", power)
+	}
+}
+
+func TestCollectKeepsTemperaturesAfterDriveError(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{{UUID: "device-a", Active: true, LastDriveLog: api.DriveLogResponse{Created: now}}},
+		temps: map[string]api.RealTimeTemperatureResponse{
+			"device-a": {{Channel: 1, Temp: 225, DegreeType: 2, Created: now}},
+		},
+		fail: map[string]error{"GetRealTimeDeviceDriveData": errors.New("boom")},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, now)
+	if temps := stat.named("fireboard.channel.temperature"); len(temps) != 1 {
+		t.Errorf("got %d temperatures, want the temperature despite the drive error", len(temps))
+	}
+	if drive := stat.named("fireboard.drive.percent"); len(drive) != 1 || !drive[0].hasTag("drive_source:last_drivelog") {
+		t.Errorf("got drive metrics %v, want only the last drive log", drive)
+	}
+	if errs := stat.named("fireboard.devices.errors"); len(errs) != 1 || !errs[0].hasTag("func:devicesGetRealtimeDeviceDriveData") {
+		t.Errorf("got errors %v, want the drive call", errs)
+	}
+	if failed := stat.named("fireboard.collect.failed_items"); len(failed) != 1 || failed[0].value != 1 {
+		t.Errorf("got failed items %v, want the device", failed)
+	}
+}
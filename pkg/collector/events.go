@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const eventSourceTypeName = "fireboard"
+
+// sentEvents remembers the lifecycle events sent per session when there is no checkpoint store.
+type sentEvents struct {
+	mu   sync.Mutex
+	sent map[string]bool
+}
+
+// eventSent returns true if the session's lifecycle event of kind was already sent.
+func (c *collector) eventSent(sessionID int64, kind string) bool {
+	if c.checkpoints != nil {
+		return c.checkpoints.EventSent(sessionID, kind)
+	}
+	c.sessionEvents.mu.Lock()
+	defer c.sessionEvents.mu.Unlock()
+	return c.sessionEvents.sent[fmt.Sprintf("%d/%s", sessionID, kind)]
+}
+
+// recordEvent records the session's lifecycle event of kind as sent, in the checkpoint store if there is one.
+func (c *collector) recordEvent(sessionID int64, kind string) {
+	if c.checkpoints != nil {
+		c.checkpoints.RecordEvent(sessionID, kind)
+		return
+	}
+	c.sessionEvents.mu.Lock()
+	defer c.sessionEvents.mu.Unlock()
+	if c.sessionEvents.sent == nil {
+		c.sessionEvents.sent = map[string]bool{}
+	}
+	c.sessionEvents.sent[fmt.Sprintf("%d/%s", sessionID, kind)] = true
+}
+
+// sessionStart returns when the session started, its creation time if no start time is set.
+func sessionStart(session api.SessionListResponse) time.Time {
+	if session.StartTime.IsZero() {
+		return session.Created
+	}
+	return session.StartTime
+}
+
+// sessionDuration returns the time between the session's start and end, or the api's duration string if either is unset.
+func sessionDuration(session api.SessionListResponse) string {
+	start := sessionStart(session)
+	if start.IsZero() || session.EndTime.IsZero() {
+		return session.Duration
+	}
+	return session.EndTime.Sub(start).Round(time.Minute).String()
+}
+
+// within returns true if t is after from and not after to.
+func within(t, from, to time.Time) bool {
+	return t.After(from) && !t.After(to)
+}
+
+// chartSummary describes the min and max of each channel in the chart, in celsius for temperatures.
+func chartSummary(chart api.SessionChartResponse) string {
+	var lines []string
+	for _, sensor := range chart {
+		conversion := unity
+		if sensor.DegreeType == 2 {
+			conversion = fToC
+		}
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, y := range sensor.Y {
+			v := float64(conversion(y))
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+		if len(sensor.Y) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s): min %.1f, max %.1f", sensor.Label, sensor.Device, lo, hi))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// emitSessionEvents emits an event for each lifecycle change of the session after cutoff and up to now: created,
+// started and ended. Each event is sent once, events already sent are recorded in the checkpoint store, or in memory
+// without one, and skipped. The session's events share an aggregation key so they are grouped in the event stream.
+// The ended event summarises the min and max of each channel of chart.
+func (c *collector) emitSessionEvents(session api.SessionListResponse, chart api.SessionChartResponse, cutoff, now time.Time, tags TagSet, stat statsd.ClientInterface) {
+	for _, id := range session.DeviceIDs {
+		tags = tags.With("device_id:" + id)
+	}
+	details := []string{}
+	if session.Description != "" {
+		details = append(details, session.Description)
+	}
+	if len(session.DeviceIDs) > 0 {
+		details = append(details, "Devices: "+strings.Join(session.DeviceIDs, ", "))
+	}
+
+	event := func(kind string, ts time.Time, alertType statsd.EventAlertType, text []string) {
+		if c.eventSent(session.ID, kind) {
+			return
+		}
+		c.recordEvent(session.ID, kind)
+		c.logger.Debug("session event", "session_id", session.ID, "event", kind)
+		stat.Event(&statsd.Event{
+			Title:          fmt.Sprintf("FireBoard session %s: %s", kind, session.Title),
+			Text:           strings.Join(text, "\n"),
+			Timestamp:      ts,
+			AggregationKey: "fireboard_session_" + strconv.FormatInt(session.ID, 10),
+			SourceTypeName: eventSourceTypeName,
+			AlertType:      alertType,
+			Tags:           tags.With("session_event:" + kind).Tags(),
+		})
+	}
+
+	if within(session.Created, cutoff, now) {
+		event("created", session.Created, statsd.Info, details)
+	}
+	if start := sessionStart(session); within(start, cutoff, now) {
+		event("started", start, statsd.Info, details)
+	}
+	if within(session.EndTime, cutoff, now) {
+		text := append(details, "Duration: "+sessionDuration(session))
+		if summary := chartSummary(chart); summary != "" {
+			text = append(text, summary)
+		}
+		event("ended", session.EndTime, statsd.Success, text)
+	}
+}
@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/checkpoint"
+)
+
+func TestCollectSendsSessionEventsOnce(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cutoff := now.Add(-time.Hour)
+	client := &fakeClient{
+		sessions: api.SessionsListResponse{{
+			ID: 2, Title: "Ribs",
+			Created: now.Add(-50 * time.Minute), StartTime: now.Add(-40 * time.Minute), EndTime: now.Add(-10 * time.Minute),
+		}},
+	}
+	collect := func(c *collector) int {
+		stat := &recordingStat{}
+		c.SetLogger(nil)
+		// the same cutoff every time, as after a failed collection
+		if err := c.Collect(context.Background(), cutoff, stat); err != nil {
+			t.Fatal(err)
+		}
+		return len(stat.events)
+	}
+
+	inMemory := NewCollector(client, nil, nil)
+	if got := collect(inMemory); got != 3 {
+		t.Fatalf("first collection: got %d events, want 3", got)
+	}
+	if got := collect(inMemory); got != 0 {
+		t.Errorf("second collection: got %d events, want none resent", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "watermarks.json")
+	for restart, want := range []int{3, 0} {
+		store, err := checkpoint.NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewCollector(client, nil, nil)
+		c.SetCheckpointStore(store)
+		if got := collect(c); got != want {
+			t.Errorf("restart %d: got %d events, want %d", restart, got, want)
+		}
+	}
+}
+
+func TestCollectEmitsSessionLifecycleEvents(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	cutoff := now.Add(-time.Hour)
+	client := &fakeClient{
+		sessions: api.SessionsListResponse{
+			{
+				ID: 1, Title: "Brisket", Description: "overnight", DeviceIDs: []string{"device-a"},
+				Created: now.Add(-2 * time.Hour), StartTime: now.Add(-30 * time.Minute), EndTime: now.Add(time.Hour),
+			},
+			{
+				ID: 2, Title: "Ribs", DeviceIDs: []string{"device-b"},
+				Created: now.Add(-50 * time.Minute), StartTime: now.Add(-40 * time.Minute), EndTime: now.Add(-10 * time.Minute),
+			},
+		},
+		charts: map[int64]api.SessionChartResponse{
+			2: {{Label: "pit", Device: "device-b", DegreeType: 2, X: []int64{1, 2, 3}, Y: []float32{212, 32, 230}}},
+		},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, cutoff)
+
+	var got []string
+	for _, e := range stat.events {
+		got = append(got, e.Title)
+		if e.SourceTypeName != "fireboard" {
+			t.Errorf("%s: source type %q", e.Title, e.SourceTypeName)
+		}
+	}
+	want := []string{
+		"FireBoard session started: Brisket",
+		"FireBoard session created: Ribs",
+		"FireBoard session started: Ribs",
+		"FireBoard session ended: Ribs",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+
+	ribs := stat.events[1:]
+	for _, e := range ribs {
+		if e.AggregationKey != "fireboard_session_2" {
+			t.Errorf("%s: aggregation key %q", e.Title, e.AggregationKey)
+		}
+		m := metric{tags: e.Tags}
+		if !m.hasTag("sessionID:2") || !m.hasTag("device_id:device-b") {
+			t.Errorf("%s: tags %v", e.Title, e.Tags)
+		}
+	}
+	ended := ribs[2]
+	if !ended.Timestamp.Equal(now.Add(-10*time.Minute)) || ended.AlertType != statsd.Success {
+		t.Errorf("ended event: timestamp %v alert type %s", ended.Timestamp, ended.AlertType)
+	}
+	for _, part := range []string{"Devices: device-b", "Duration: 30m0s", "pit (device-b): min 0.0, max 110.0"} {
+		if !strings.Contains(ended.Text, part) {
+			t.Errorf("ended event text missing %q:\n%s", part, ended.Text)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// SetHashAccessPointMAC replaces the ap_mac tag value with a short keyed hash, so access points can be told apart
+// without reporting their address. Without a hash secret the tag is dropped instead.
+func (c *collector) SetHashAccessPointMAC(hash bool) {
+	c.hashAPMAC = hash
+}
+
+// SetHashSecret sets the key of the HMAC used to hash network identifiers. A plain hash of a mac address is easily
+// reversed by hashing every address of the vendor's range, the key must stay private for the hashes to be.
+func (c *collector) SetHashSecret(secret []byte) {
+	c.hashSecret = secret
+}
+
+// hashIdentifier returns a short HMAC-SHA256 of a network identifier keyed by the hash secret, false without a secret.
+func (c *collector) hashIdentifier(value string) (string, bool) {
+	if len(c.hashSecret) == 0 {
+		return "", false
+	}
+	return keyedHash(c.hashSecret, value), true
+}
+
+// keyedHash returns a short hex HMAC-SHA256 of value keyed by key.
+func keyedHash(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// randomKey returns a random HMAC key, used when no hash secret is configured.
+func randomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// apMACTag returns the ap_mac tag, hashed if configured, or an empty tag if the device has not reported one or it
+// must be hashed without a hash secret.
+func (c *collector) apMACTag(mac string) string {
+	mac = strings.ToLower(strings.TrimSpace(mac))
+	if mac == "" {
+		return ""
+	}
+	if c.hashAPMAC {
+		hashed, ok := c.hashIdentifier(mac)
+		if !ok {
+			return ""
+		}
+		mac = hashed
+	}
+	return "ap_mac:" + mac
+}
+
+// emitHardware emits the wireless signal, onboard temperature and uptime of the device. The wifi metrics are tagged
+// with the band, frequency and access point, values the device has not reported are skipped.
+func (c *collector) emitHardware(device api.DevicePropertiesResponse, tags TagSet, stat statsd.ClientInterface) {
+	deviceLog := device.DeviceLog
+	wifiTags := tags
+	if deviceLog.Band != "" {
+		wifiTags = wifiTags.With("band:" + deviceLog.Band)
+	}
+	if deviceLog.Frequency != "" {
+		wifiTags = wifiTags.With("frequency:" + strings.ReplaceAll(deviceLog.Frequency, " ", ""))
+	}
+	wifiTags = wifiTags.With(c.apMACTag(deviceLog.AccesPointMAC))
+
+	if deviceLog.SignalLevel != 0 {
+		stat.Gauge("fireboard.device.wifi.signal_level", float64(deviceLog.SignalLevel), wifiTags.Tags(), 1.0)
+	}
+	if deviceLog.TxPower != 0 {
+		stat.Gauge("fireboard.device.wifi.tx_power", float64(deviceLog.TxPower), wifiTags.Tags(), 1.0)
+	}
+	if deviceLog.BLESignalLevel != 0 {
+		stat.Gauge("fireboard.device.ble.signal_level", float64(deviceLog.BLESignalLevel), tags.Tags(), 1.0)
+	}
+	if deviceLog.OnboardTemperature != 0 {
+		stat.Gauge("fireboard.device.onboard_temperature", float64(deviceLog.OnboardTemperature), tags.Tags(), 1.0)
+	}
+	if uptime := deviceLog.UptimeSeconds(); uptime > 0 {
+		stat.Gauge("fireboard.device.uptime", uptime, tags.Tags(), 1.0)
+	}
+}
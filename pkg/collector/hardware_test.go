@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestAPMACTagIsKeyed(t *testing.T) {
+	c := NewCollector(&fakeClient{}, nil, nil)
+	if got := c.apMACTag(" 00:00:5E:00:53:AA "); got != "ap_mac:00:00:5e:00:53:aa" {
+		t.Errorf("unhashed: got %q", got)
+	}
+
+	c.SetHashAccessPointMAC(true)
+	if got := c.apMACTag("00:00:5E:00:53:AA"); got != "" {
+		t.Errorf("hashing without a secret: got %q, want the tag dropped", got)
+	}
+
+	c.SetHashSecret([]byte("secret"))
+	a := c.apMACTag("00:00:5E:00:53:AA")
+	if a == "" || a != c.apMACTag("00:00:5e:00:53:aa") {
+		t.Fatalf("got %q, want a stable hash for the same address", a)
+	}
+	if a == c.apMACTag("00:00:5E:00:53:AB") {
+		t.Error("different addresses hashed the same")
+	}
+	c.SetHashSecret([]byte("another secret"))
+	if a == c.apMACTag("00:00:5E:00:53:AA") {
+		t.Error("the hash does not depend on the secret")
+	}
+}
+
+func TestCollectEmitsWirelessAndHardwareMetrics(t *testing.T) {
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{{
+			UUID: "device-a", Active: true,
+			DeviceLog: api.DeviceLog{
+				SignalLevel: -58, TxPower: 20, BLESignalLevel: -93, OnboardTemperature: 38.5, Uptime: "121:07",
+				Band: "802.11bgn", Frequency: "2.437 GHz", AccesPointMAC: "00:00:5E:00:53:AA",
+			},
+		}},
+	}
+	for _, hash := range []bool{false, true} {
+		c, stat := newTestCollector(client)
+		c.SetHashAccessPointMAC(hash)
+		c.SetHashSecret([]byte("secret"))
+		mustCollect(t, c, time.Now())
+
+		want := map[string]float64{
+			"fireboard.device.wifi.signal_level":   -58,
+			"fireboard.device.wifi.tx_power":       20,
+			"fireboard.device.ble.signal_level":    -93,
+			"fireboard.device.onboard_temperature": 38.5,
+			"fireboard.device.uptime":              121*3600 + 7*60,
+		}
+		for name, v := range want {
+			got := stat.named(name)
+			if len(got) != 1 || got[0].value != v {
+				t.Errorf("%s: got %v, want %v", name, got, v)
+			}
+		}
+		signal := stat.named("fireboard.device.wifi.signal_level")[0]
+		apMAC := signal.tagWithPrefix("ap_mac:")
+		if !signal.hasTag("band:802.11bgn") || !signal.hasTag("frequency:2.437GHz") || len(apMAC) != 1 {
+			t.Fatalf("wifi tags: %v", signal.tags)
+		}
+		if raw := apMAC[0] == "ap_mac:00:00:5e:00:53:aa"; raw == hash {
+			t.Errorf("hash %v: got %s", hash, apMAC[0])
+		}
+		if ble := stat.named("fireboard.device.ble.signal_level")[0]; len(ble.tagWithPrefix("band:")) != 0 {
+			t.Errorf("wifi tags on the ble signal: %v", ble.tags)
+		}
+	}
+}
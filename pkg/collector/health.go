@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const (
+	defaultOnlineWarning  = 5 * time.Minute
+	defaultOnlineCritical = 15 * time.Minute
+)
+
+// OnlineThresholds are the ages of a device's last report at which fireboard.device.online turns WARNING and CRITICAL.
+type OnlineThresholds struct {
+	Warning  time.Duration
+	Critical time.Duration
+}
+
+func (t OnlineThresholds) withDefaults() OnlineThresholds {
+	if t.Warning <= 0 {
+		t.Warning = defaultOnlineWarning
+	}
+	if t.Critical <= 0 {
+		t.Critical = defaultOnlineCritical
+	}
+	if t.Critical < t.Warning {
+		t.Critical = t.Warning
+	}
+	return t
+}
+
+// ParseOnlineThresholds parses per device thresholds: comma separated uuid=warning/critical, e.g. "abc=10m/30m".
+func ParseOnlineThresholds(val string) (map[string]OnlineThresholds, error) {
+	out := map[string]OnlineThresholds{}
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		uuid, durations, ok := strings.Cut(entry, "=")
+		warning, critical, ok2 := strings.Cut(durations, "/")
+		if !ok || !ok2 || uuid == "" {
+			return nil, fmt.Errorf("invalid online threshold %q, expected uuid=warning/critical", entry)
+		}
+		var t OnlineThresholds
+		var err error
+		if t.Warning, err = time.ParseDuration(warning); err != nil {
+			return nil, fmt.Errorf("invalid warning threshold for %s: %w", uuid, err)
+		}
+		if t.Critical, err = time.ParseDuration(critical); err != nil {
+			return nil, fmt.Errorf("invalid critical threshold for %s: %w", uuid, err)
+		}
+		out[uuid] = t
+	}
+	return out, nil
+}
+
+// NewOnlineThresholdsFromEnv reads the default thresholds from FIREBOARD_ONLINE_WARNING and FIREBOARD_ONLINE_CRITICAL
+// and the per device thresholds from FIREBOARD_ONLINE_THRESHOLDS, an unparsable or non-positive duration is an error.
+func NewOnlineThresholdsFromEnv() (OnlineThresholds, map[string]OnlineThresholds, error) {
+	var defaults OnlineThresholds
+	for name, d := range map[string]*time.Duration{
+		"FIREBOARD_ONLINE_WARNING":  &defaults.Warning,
+		"FIREBOARD_ONLINE_CRITICAL": &defaults.Critical,
+	} {
+		if val, ok := os.LookupEnv(name); ok && val != "" {
+			parsed, err := time.ParseDuration(val)
+			if err != nil {
+				return OnlineThresholds{}, nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			if parsed <= 0 {
+				return OnlineThresholds{}, nil, fmt.Errorf("invalid %s: %s is not positive", name, val)
+			}
+			*d = parsed
+		}
+	}
+	perDevice, err := ParseOnlineThresholds(os.Getenv("FIREBOARD_ONLINE_THRESHOLDS"))
+	return defaults.withDefaults(), perDevice, err
+}
+
+// SetOnlineThresholds sets the default fireboard.device.online thresholds and overrides keyed by device uuid.
+func (c *collector) SetOnlineThresholds(defaults OnlineThresholds, perDevice map[string]OnlineThresholds) {
+	c.onlineThresholds = defaults.withDefaults()
+	c.deviceOnlineThresholds = make(map[string]OnlineThresholds, len(perDevice))
+	for uuid, t := range perDevice {
+		c.deviceOnlineThresholds[uuid] = t.withDefaults()
+	}
+}
+
+// emitCanConnect sends the fireboard.can_connect service check with the error, if any, as the message. auth is set
+// for the result of an authentication request, where any response rejecting it means the credentials are bad.
+func (c *collector) emitCanConnect(err error, auth bool, stat statsd.ClientInterface) {
+	check := &statsd.ServiceCheck{
+		Name:   "fireboard.can_connect",
+		Status: canConnectStatus(err, auth),
+		Tags:   c.tags.Tags(),
+	}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	stat.ServiceCheck(check)
+}
+
+// canConnectStatus is CRITICAL when the API could not be reached or rejected the credentials and WARNING for any
+// other failure. A rate limit, an open circuit breaker, an exhausted request budget or a missing or expired token does
+// not show the API is down.
+func canConnectStatus(err error, auth bool) statsd.ServiceCheckStatus {
+	var urlErr *url.Error
+	var statusErr *api.StatusError
+	switch {
+	case err == nil:
+		return statsd.Ok
+	case errors.Is(err, api.ErrRateLimited), errors.Is(err, api.ErrCircuitOpen), errors.Is(err, api.ErrBudgetExhausted):
+		return statsd.Warn
+	case errors.As(err, &urlErr), errors.Is(err, context.DeadlineExceeded):
+		return statsd.Critical
+	case errors.As(err, &statusErr):
+		// the login endpoint rejects bad credentials with a 400
+		if statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden || auth && statusErr.StatusCode < 500 {
+			return statsd.Critical
+		}
+	}
+	return statsd.Warn
+}
+
+// lastReport returns the most recent of the device's last temperature log and device log.
+func lastReport(device api.DevicePropertiesResponse) time.Time {
+	if device.DeviceLog.Date.After(device.LastTempLog) {
+		return device.DeviceLog.Date
+	}
+	return device.LastTempLog
+}
+
+// emitDeviceOnline sends the fireboard.device.online service check from the age of the device's last report.
+func (c *collector) emitDeviceOnline(device api.DevicePropertiesResponse, tags TagSet, stat statsd.ClientInterface) {
+	thresholds, ok := c.deviceOnlineThresholds[device.UUID]
+	if !ok {
+		thresholds = c.onlineThresholds
+	}
+	check := &statsd.ServiceCheck{
+		Name:   "fireboard.device.online",
+		Status: statsd.Ok,
+		Tags:   tags.Tags(),
+	}
+	last := lastReport(device)
+	age := time.Since(last).Round(time.Second)
+	switch {
+	case last.IsZero():
+		check.Status = statsd.Critical
+		check.Message = "device has never reported"
+	case age > thresholds.Critical:
+		check.Status = statsd.Critical
+		check.Message = fmt.Sprintf("last report %s ago", age)
+	case age > thresholds.Warning:
+		check.Status = statsd.Warn
+		check.Message = fmt.Sprintf("last report %s ago", age)
+	}
+	stat.ServiceCheck(check)
+}
@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestCanConnectStatus(t *testing.T) {
+	transportErr := &url.Error{Op: "Get", URL: "https://fireboard.io", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		err  error
+		auth bool
+		want statsd.ServiceCheckStatus
+	}{
+		{"ok", nil, false, statsd.Ok},
+		{"transport", transportErr, false, statsd.Critical},
+		{"timeout", fmt.Errorf("list devices: %w", context.DeadlineExceeded), false, statsd.Critical},
+		{"no token", api.ErrNoValidToken, false, statsd.Warn},
+		{"unauthorized", &api.StatusError{Endpoint: "devices", StatusCode: 401}, false, statsd.Critical},
+		{"bad credentials", &api.StatusError{Endpoint: "auth", StatusCode: 400}, true, statsd.Critical},
+		{"server error", &api.StatusError{Endpoint: "devices", StatusCode: 503}, false, statsd.Warn},
+		{"server error on auth", &api.StatusError{Endpoint: "auth", StatusCode: 503}, true, statsd.Warn},
+		{"rate limited", api.ErrRateLimited, false, statsd.Warn},
+		{"circuit open", &api.CircuitOpenError{Endpoint: "devices", RetryAfter: time.Second}, false, statsd.Warn},
+		{"budget exhausted", api.ErrBudgetExhausted, true, statsd.Warn},
+		{"decode", errors.New("invalid character"), false, statsd.Warn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canConnectStatus(tt.err, tt.auth); got != tt.want {
+				t.Errorf("got status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEmitsCanConnect(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want statsd.ServiceCheckStatus
+	}{
+		{"success", nil, statsd.Ok},
+		{"rejected", &api.StatusError{Endpoint: "auth", StatusCode: 400}, statsd.Critical},
+		{"budget exhausted", api.ErrBudgetExhausted, statsd.Warn},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{fail: map[string]error{}}
+			if tt.err != nil {
+				client.fail["GetAuthToken"] = tt.err
+			}
+			c, stat := newTestCollector(client, "env:test")
+			c.Authenticate(context.Background(), "user", "password")
+			checks := stat.namedChecks("fireboard.can_connect")
+			if len(checks) != 1 || checks[0].Status != tt.want {
+				t.Errorf("got %+v, want one check with status %d", checks, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOnlineThresholdsFromEnv(t *testing.T) {
+	t.Setenv("FIREBOARD_ONLINE_WARNING", "2m")
+	t.Setenv("FIREBOARD_ONLINE_CRITICAL", "")
+	t.Setenv("FIREBOARD_ONLINE_THRESHOLDS", "abc=10m/30m")
+	defaults, perDevice, err := NewOnlineThresholdsFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaults != (OnlineThresholds{Warning: 2 * time.Minute, Critical: defaultOnlineCritical}) || len(perDevice) != 1 {
+		t.Errorf("got %v and %v", defaults, perDevice)
+	}
+
+	for _, tt := range []struct{ name, val string }{
+		{"FIREBOARD_ONLINE_WARNING", "soon"},
+		{"FIREBOARD_ONLINE_CRITICAL", "-1m"},
+		{"FIREBOARD_ONLINE_THRESHOLDS", "abc=x/2m"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, tt.val)
+			if _, _, err := NewOnlineThresholdsFromEnv(); err == nil {
+				t.Errorf("%s=%s: expected an error", tt.name, tt.val)
+			}
+		})
+	}
+}
+
+func TestCollectEmitsServiceChecks(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{
+			{UUID: "fresh", Active: true, LastTempLog: now.Add(-time.Minute)},
+			{UUID: "stale", Active: true, LastTempLog: now.Add(-10 * time.Minute)},
+			{UUID: "gone", Active: true, DeviceLog: api.DeviceLog{Date: now.Add(-time.Hour)}},
+			{UUID: "relaxed", Active: true, LastTempLog: now.Add(-time.Hour), DeviceLog: api.DeviceLog{Date: now.Add(-10 * time.Minute)}},
+			{UUID: "never", Active: true},
+		},
+	}
+	c, stat := newTestCollector(client, "env:test")
+	c.SetOnlineThresholds(OnlineThresholds{}, map[string]OnlineThresholds{"relaxed": {Warning: 15 * time.Minute, Critical: time.Hour}})
+	mustCollect(t, c, now)
+
+	connect := stat.namedChecks("fireboard.can_connect")
+	if len(connect) != 1 || connect[0].Status != statsd.Ok {
+		t.Errorf("can_connect: got %+v, want one OK check", connect)
+	}
+	want := map[string]statsd.ServiceCheckStatus{
+		"uuid:fresh":   statsd.Ok,
+		"uuid:stale":   statsd.Warn,
+		"uuid:gone":    statsd.Critical,
+		"uuid:relaxed": statsd.Ok,
+		"uuid:never":   statsd.Critical,
+	}
+	online := stat.namedChecks("fireboard.device.online")
+	if len(online) != len(want) {
+		t.Fatalf("got %d online checks, want %d", len(online), len(want))
+	}
+	for _, sc := range online {
+		m := metric{tags: sc.Tags}
+		uuid := m.tagWithPrefix("uuid:")
+		if len(uuid) != 1 || !m.hasTag("env:test") {
+			t.Errorf("online check tags: %v", sc.Tags)
+			continue
+		}
+		if sc.Status != want[uuid[0]] {
+			t.Errorf("%s: got status %d, want %d (%s)", uuid[0], sc.Status, want[uuid[0]], sc.Message)
+		}
+	}
+}
+
+func TestParseOnlineThresholds(t *testing.T) {
+	got, err := ParseOnlineThresholds("abc=10m/30m, def=1m/2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["abc"] != (OnlineThresholds{Warning: 10 * time.Minute, Critical: 30 * time.Minute}) || got["def"] != (OnlineThresholds{Warning: time.Minute, Critical: 2 * time.Minute}) {
+		t.Errorf("got %v", got)
+	}
+	for _, invalid := range []string{"abc", "abc=10m", "=1m/2m", "abc=x/2m"} {
+		if _, err := ParseOnlineThresholds(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestCollectSkipsCanConnectForExpiredToken(t *testing.T) {
+	c, stat := newTestCollector(&fakeClient{fail: map[string]error{"ListDevices": api.ErrExpiredToken}})
+	if err := c.Collect(context.Background(), time.Now(), nil); !errors.Is(err, api.ErrExpiredToken) {
+		t.Fatalf("got error %v, want the expired token", err)
+	}
+	if checks := stat.namedChecks("fireboard.can_connect"); len(checks) != 0 {
+		t.Errorf("got can_connect %+v, want none before re-authenticating", checks[0])
+	}
+}
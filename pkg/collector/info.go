@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// emitDeviceInfo emits fireboard.device.info with a value of 1, tagged with the device's model, identifiers and
+// firmware versions for an inventory of every device, active or not. Unreported values are left out.
+func (c *collector) emitDeviceInfo(device api.DevicePropertiesResponse, tags TagSet, stat statsd.ClientInterface) {
+	deviceLog := device.DeviceLog
+	model := device.Model
+	if model == "" {
+		model = deviceLog.Model
+	}
+	info := []string{
+		"active:" + strconv.FormatBool(device.Active),
+		"channel_count:" + strconv.FormatInt(device.ChannelCount, 10),
+	}
+	for name, val := range map[string]string{
+		"device_title":     device.Title,
+		"model":            model,
+		"yfb_model":        deviceLog.YFBModel,
+		"hardware_id":      device.HardwareID,
+		"board_id":         deviceLog.BoardID,
+		"firmware_version": device.Version,
+		"fbj_version":      device.FireBoardJVersion,
+		"fbn_version":      device.FireBoardNVersion,
+		"fbu_version":      device.FireBoardUVersion,
+		"java_version":     deviceLog.VersionJava,
+		"node_version":     deviceLog.NodeVersion,
+		"image_version":    deviceLog.VersionImage,
+		"utils_version":    deviceLog.UtilsVersion,
+	} {
+		if val != "" {
+			info = append(info, name+":"+val)
+		}
+	}
+	stat.Gauge("fireboard.device.info", 1, tags.With(info...).Tags(), 1.0)
+}
@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestCollectEmitsDeviceInfoForEveryDevice(t *testing.T) {
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{
+			{
+				UUID: "device-a", Title: "Smoker", Active: true, Model: "FBX2D", HardwareID: "FB2D1234", ChannelCount: 6,
+				Version: "2.1.4", FireBoardJVersion: "1.0", FireBoardNVersion: "2.0", FireBoardUVersion: "3.0",
+				DeviceLog: api.DeviceLog{YFBModel: "YS640", BoardID: "GCMABCD12", VersionJava: "11", NodeVersion: "16.3", VersionImage: "5", UtilsVersion: "1.2"},
+			},
+			{UUID: "device-b", DeviceLog: api.DeviceLog{Model: "FBX2"}},
+		},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, time.Now())
+
+	info := stat.named("fireboard.device.info")
+	if len(info) != 2 {
+		t.Fatalf("got %d info gauges, want one per device", len(info))
+	}
+	want := []string{
+		"uuid:device-a", "active:true", "channel_count:6", "device_title:Smoker", "model:FBX2D", "yfb_model:YS640",
+		"hardware_id:FB2D1234", "board_id:GCMABCD12", "firmware_version:2.1.4", "fbj_version:1.0", "fbn_version:2.0",
+		"fbu_version:3.0", "java_version:11", "node_version:16.3", "image_version:5", "utils_version:1.2",
+	}
+	if info[0].value != 1 || len(info[0].tags) != len(want) {
+		t.Errorf("device-a: got %v with tags %v", info[0].value, info[0].tags)
+	}
+	for _, tag := range want {
+		if !info[0].hasTag(tag) {
+			t.Errorf("device-a: missing %s in %v", tag, info[0].tags)
+		}
+	}
+	if got, want := strings.Join(info[1].tags, ","), "active:false,channel_count:0,model:FBX2,uuid:device-b"; got != want {
+		t.Errorf("device-b: got %s, want %s", got, want)
+	}
+}
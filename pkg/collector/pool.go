@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// runBounded calls fn for items [0, n) with at most workers calls in flight, each bounded by timeout.
+// The returned errors are indexed by item so callers can report them in a deterministic order.
+func runBounded(ctx context.Context, n, workers int, timeout time.Duration, fn func(ctx context.Context, i int) error) []error {
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	items := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				itemCtx, cancel := context.WithTimeout(ctx, timeout)
+				errs[i] = fn(itemCtx, i)
+				cancel()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			errs[i] = ctx.Err()
+			continue
+		}
+		items <- i
+	}
+	close(items)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,151 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestRunBoundedLimitsWorkers(t *testing.T) {
+	var inFlight, peak atomic.Int64
+	errs := runBounded(context.Background(), 20, 3, time.Second, func(ctx context.Context, i int) error {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		inFlight.Add(-1)
+		if i%5 == 0 {
+			return fmt.Errorf("item %d", i)
+		}
+		return nil
+	})
+	if got := peak.Load(); got > 3 || got < 1 {
+		t.Errorf("peak workers: got %d, want at most 3", got)
+	}
+	for i, err := range errs {
+		if (err != nil) != (i%5 == 0) {
+			t.Errorf("item %d: got error %v", i, err)
+		}
+		if err != nil && err.Error() != fmt.Sprintf("item %d", i) {
+			t.Errorf("item %d: error reported under the wrong index: %v", i, err)
+		}
+	}
+}
+
+func TestRunBoundedTimesOutEachItem(t *testing.T) {
+	start := time.Now()
+	errs := runBounded(context.Background(), 2, 2, 20*time.Millisecond, func(ctx context.Context, i int) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("item context has no deadline")
+		}
+		if i == 1 {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(errs[0], context.DeadlineExceeded) || errs[1] != nil {
+		t.Errorf("got %v, want only the first item to time out", errs)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took %s, the timeout did not cancel the item", elapsed)
+	}
+}
+
+func TestRunBoundedSkipsItemsAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Int64
+	errs := runBounded(ctx, 10, 1, time.Second, func(ctx context.Context, i int) error {
+		ran.Add(1)
+		if i == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if got := ran.Load(); got > 4 {
+		t.Errorf("%d items ran after the context was cancelled", got)
+	}
+	if !errors.Is(errs[9], context.Canceled) {
+		t.Errorf("last item: got %v, want context.Canceled", errs[9])
+	}
+}
+
+func TestFlushAllReplaysInItemOrder(t *testing.T) {
+	stat := &recordingStat{}
+	stats := make([]*bufferedStat, 5)
+	var wg sync.WaitGroup
+	for i := range stats {
+		if i == 3 {
+			continue // an item that never ran
+		}
+		stats[i] = newBufferedStat(stat)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(5-i) * time.Millisecond) // finish in reverse order
+			stats[i].Gauge("item", float64(i), nil, 1.0)
+			stats[i].Incr("item", nil, 1.0)
+		}(i)
+	}
+	wg.Wait()
+	if len(stat.metrics) != 0 {
+		t.Fatalf("emitted before the flush: %+v", stat.metrics)
+	}
+	flushAll(stats)
+
+	var got []float64
+	for _, m := range stat.named("item") {
+		got = append(got, m.value)
+	}
+	want := []float64{0, 1, 1, 1, 2, 1, 4, 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	flushAll(stats)
+	if len(stat.metrics) != len(want) {
+		t.Error("a second flush replayed the emissions again")
+	}
+}
+
+func TestCollectReportsFailedItemsWithoutFailing(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices:  api.ListDevicesResponse{{UUID: "device-a", Active: true}, {UUID: "device-b", Active: true}},
+		sessions: api.SessionsListResponse{{ID: 1, EndTime: now.Add(time.Hour)}},
+		fail: map[string]error{
+			"GetRealTimeDeviceTemperature/device-a": errors.New("boom"),
+			"GetSessionChartData/1":                 errors.New("boom"),
+		},
+	}
+	stat := &recordingStat{}
+	c := NewCollector(client, stat, nil)
+	c.SetLogger(nil)
+	if err := c.Collect(context.Background(), now.Add(-time.Hour), nil); err != nil {
+		t.Fatalf("a failed device or session failed the collection: %v", err)
+	}
+	failed := map[string]float64{}
+	for _, m := range stat.named("fireboard.collect.failed_items") {
+		failed[m.tagWithPrefix("kind:")[0]] += m.value
+	}
+	if failed["kind:device"] != 1 || failed["kind:session"] != 1 {
+		t.Errorf("got failed items %v, want one device and one session", failed)
+	}
+	if active := stat.named("fireboard.devices.active"); len(active) != 2 {
+		t.Errorf("got %d active devices, want both reported", len(active))
+	}
+
+	client.fail = map[string]error{"ListAllSessions": errors.New("boom")}
+	if err := c.Collect(context.Background(), now.Add(-time.Hour), nil); err == nil {
+		t.Error("expected listing the sessions to fail the collection")
+	}
+}
@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/rules"
+)
+
+// SetRulesEngine evaluates the user defined temperature rules of engine against every fresh realtime temperature,
+// nil disables them.
+func (c *collector) SetRulesEngine(engine *rules.Engine) {
+	c.rulesEngine = engine
+}
+
+// evaluateRules passes the device's fresh channel temperatures, in celsius, to the rules engine. Notification failures
+// are logged and counted but do not fail the collection.
+func (c *collector) evaluateRules(ctx context.Context, device api.DevicePropertiesResponse, temps api.RealTimeTemperatureResponse, tags TagSet, now time.Time, stat statsd.ClientInterface) {
+	if c.rulesEngine == nil {
+		return
+	}
+	labels := channelLabels(device)
+	readings := make([]rules.Reading, 0, len(temps))
+	for _, t := range temps {
+		if t.Created.IsZero() || now.Sub(t.Created) > maxTemperatureAge {
+			continue
+		}
+		conversion := unity
+		if t.DegreeType == 2 {
+			conversion = fToC
+		}
+		readings = append(readings, rules.Reading{
+			DeviceUUID:  device.UUID,
+			DeviceTitle: device.Title,
+			Channel:     t.Channel,
+			Label:       labels[t.Channel],
+			Celsius:     float64(conversion(t.Temp)),
+			Time:        t.Created,
+		})
+	}
+	if err := c.rulesEngine.Evaluate(ctx, readings); err != nil {
+		stat.Incr("fireboard.devices.errors", tags.With("func:rulesNotify").Tags(), 1.0)
+		c.logger.Error("unable to send rule notifications", "func", "rulesNotify", "device_uuid", device.UUID, "error", err)
+	}
+}
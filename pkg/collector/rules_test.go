@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/rules"
+)
+
+type recordingNotifier struct {
+	notifications []rules.Notification
+	err           error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n rules.Notification) error {
+	r.notifications = append(r.notifications, n)
+	return r.err
+}
+
+func TestEvaluateRulesConvertsAndSkipsStaleReadings(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	target := 203.0
+	notifier := &recordingNotifier{err: errors.New("unreachable")}
+	engine, err := rules.NewEngine([]rules.Rule{{Name: "brisket done", Channel: "brisket", Unit: "F", Above: &target}}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetLogger(nil)
+	c.SetRulesEngine(engine)
+
+	device := api.DevicePropertiesResponse{
+		UUID:     "device-a",
+		Title:    "Smoker",
+		Channels: []api.ChannelResponse{{Channel: 1, ChannelLabel: "Brisket"}, {Channel: 2, ChannelLabel: "Brisket"}},
+	}
+	temps := api.RealTimeTemperatureResponse{
+		{Channel: 1, Temp: 204, DegreeType: 2, Created: now.Add(-10 * time.Second)},
+		{Channel: 2, Temp: 210, DegreeType: 2, Created: now.Add(-10 * time.Minute)},
+	}
+	stat := &recordingStat{}
+	c.evaluateRules(context.Background(), device, temps, NewTagSet("uuid:device-a"), now, stat)
+
+	if len(notifier.notifications) != 1 {
+		t.Fatalf("got %+v, want one notification for the fresh reading", notifier.notifications)
+	}
+	if n := notifier.notifications[0]; n.Channel != 1 || n.Value < 203.9 || n.Value > 204.1 {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+	errs := stat.named("fireboard.devices.errors")
+	if len(errs) != 1 || !errs[0].hasTag("func:rulesNotify") {
+		t.Errorf("got errors %+v, want the failed notification counted", errs)
+	}
+}
@@ -0,0 +1,189 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const (
+	minInterval            = time.Minute
+	defaultInitialLookback = 30 * time.Minute
+	defaultShutdownTimeout = 10 * time.Second
+	tokenRenewMargin       = 5 * time.Minute // the token is renewed this long before it expires
+)
+
+// Config configures the long-running collection loop.
+type Config struct {
+	Username        string        // fireboard account username, used to authenticate and re-authenticate when the token expires
+	Password        string        // fireboard account password
+	Interval        time.Duration // time between the start of each collection, zero derives it from the api request budget
+	Jitter          time.Duration // up to this much random delay is added before each collection
+	InitialLookback time.Duration // cutoff for the first collection relative to start, defaults to 30 minutes
+	ShutdownTimeout time.Duration // time an in-flight collection may take to finish after shutdown, defaults to 10 seconds
+}
+
+// NewConfigFromEnv reads the loop configuration from the environment.
+func NewConfigFromEnv() Config {
+	cfg := Config{
+		Username: os.Getenv("FIREBOARD_USERNAME"),
+		Password: os.Getenv("FIREBOARD_PASSWORD"),
+	}
+	for name, d := range map[string]*time.Duration{
+		"FIREBOARD_INTERVAL":         &cfg.Interval,
+		"FIREBOARD_JITTER":           &cfg.Jitter,
+		"FIREBOARD_INITIAL_LOOKBACK": &cfg.InitialLookback,
+		"FIREBOARD_SHUTDOWN_TIMEOUT": &cfg.ShutdownTimeout,
+	} {
+		if val, ok := os.LookupEnv(name); ok && val != "" {
+			if parsed, err := time.ParseDuration(val); err == nil && parsed > 0 {
+				*d = parsed
+			}
+		}
+	}
+	return cfg
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.Interval < 0 {
+		cfg.Interval = 0
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	}
+	if cfg.InitialLookback <= 0 {
+		cfg.InitialLookback = defaultInitialLookback
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = defaultShutdownTimeout
+	}
+	return cfg
+}
+
+// budgetInterval returns the interval at which collections using requests api requests each stay within 90% of the
+// hourly limit, leaving room for re-authentication, and never less than minInterval.
+func budgetInterval(requests int64, limit int) time.Duration {
+	interval := time.Duration(requests) * time.Hour / time.Duration(limit*9/10+1)
+	if interval < minInterval {
+		return minInterval
+	}
+	return interval.Round(time.Second)
+}
+
+// Run collects every cfg.Interval until ctx is done, then flushes and closes the statsd client and closes the log sink.
+// Without an interval
+// the time until the next collection is derived from the api requests the last collection used, so the collector
+// stays within the hourly request budget as devices and sessions are added.
+// Collections never overlap, a collection that runs past the next start is reported as an overrun
+// and the starts it missed as skipped. The cutoff advances to the start of the last successful collection.
+func (c *collector) Run(ctx context.Context, cfg Config) error {
+	cfg = cfg.withDefaults()
+	if cfg.Username == "" || cfg.Password == "" {
+		return fmt.Errorf("a fireboard username and password are required")
+	}
+	defer func() {
+		if err := c.stat.Flush(); err != nil {
+			c.logger.Warn("unable to flush statsd client", "error", err)
+		}
+		if err := c.stat.Close(); err != nil {
+			c.logger.Warn("unable to close statsd client", "error", err)
+		}
+		if c.logSink != nil {
+			if err := c.logSink.Close(); err != nil {
+				c.logger.Warn("unable to close log sink", "error", err)
+			}
+		}
+	}()
+
+	budget := c.client.GetRequestBudget()
+	cutoff := c.clock.now().Add(-cfg.InitialLookback)
+	next := c.clock.now()
+	var renewAt time.Time // zero until authenticated
+	for {
+		delay := next.Sub(c.clock.now())
+		if cfg.Jitter > 0 {
+			delay += time.Duration(c.clock.jitter(int64(cfg.Jitter)))
+		}
+		select {
+		case <-ctx.Done():
+		case <-c.clock.after(delay):
+		}
+		// shutdown wins over a start that is due at the same time
+		if ctx.Err() != nil {
+			c.logger.Info("collector stopped", "reason", ctx.Err())
+			return nil
+		}
+
+		start := c.clock.now()
+		taken := budget.Total()
+		if err := c.runOnce(ctx, cfg, cutoff, &renewAt); err != nil {
+			c.logger.Error("collection failed", "cutoff", cutoff, "error", err)
+		} else {
+			cutoff = start
+		}
+
+		interval := cfg.Interval
+		if interval == 0 {
+			interval = budgetInterval(budget.Total()-taken, budget.Limit())
+			c.logger.Debug("derived collection interval", "interval", interval, "requests", budget.Total()-taken, "limit", budget.Limit())
+		}
+		next = next.Add(interval)
+		if now := c.clock.now(); now.After(next) {
+			skipped := int64(now.Sub(next)/interval) + 1
+			next = next.Add(time.Duration(skipped) * interval)
+			c.stat.Incr("fireboard.collect.overrun", c.tags.Tags(), 1.0)
+			c.stat.Count("fireboard.collect.skipped", skipped, c.tags.Tags(), 1.0)
+			c.logger.Warn("collection overran the interval", "duration", now.Sub(start), "interval", interval, "skipped", skipped)
+		}
+	}
+}
+
+// runOnce authenticates if needed or the token is about to expire and runs a single collection, re-authenticating once
+// if the token was still rejected as missing or expired.
+// Shutdown lets the collection finish for up to cfg.ShutdownTimeout before its api calls are cancelled.
+func (c *collector) runOnce(ctx context.Context, cfg Config, cutoff time.Time, renewAt *time.Time) error {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(cfg.ShutdownTimeout, cancel)
+	})
+	defer stop()
+
+	if renewAt.IsZero() || !c.clock.now().Before(*renewAt) {
+		if err := c.renewToken(runCtx, cfg, renewAt); err != nil {
+			return err
+		}
+	}
+	err := c.collect(runCtx, cutoff, c.stat)
+	if errors.Is(err, api.ErrNoValidToken) || errors.Is(err, api.ErrExpiredToken) {
+		if err := c.renewToken(runCtx, cfg, renewAt); err != nil {
+			return err
+		}
+		err = c.collect(runCtx, cutoff, c.stat)
+	}
+	return err
+}
+
+// renewToken authenticates and sets renewAt to tokenRenewMargin before the new token expires, or zero on failure.
+func (c *collector) renewToken(ctx context.Context, cfg Config, renewAt *time.Time) error {
+	*renewAt = time.Time{}
+	if err := c.Authenticate(ctx, cfg.Username, cfg.Password); err != nil {
+		return err
+	}
+	*renewAt = c.clock.now().Add(api.TokenLifetime - tokenRenewMargin)
+	return nil
+}
+
+// runClock is the time source of the collection loop, replaced in tests.
+type runClock struct {
+	now    func() time.Time
+	after  func(d time.Duration) <-chan time.Time
+	jitter func(n int64) int64 // random value in [0, n)
+}
+
+var systemClock = runClock{now: time.Now, after: time.After, jitter: rand.Int63n}
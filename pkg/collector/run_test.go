@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/logs"
+)
+
+// fakeClock advances by every delay waited on, so Run never sleeps.
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	delays []time.Duration
+}
+
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+func (f *fakeClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+}
+
+func (f *fakeClock) after(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	f.delays = append(f.delays, d)
+	if d > 0 {
+		f.t = f.t.Add(d)
+	}
+	ch := make(chan time.Time, 1)
+	ch <- f.t
+	f.mu.Unlock()
+	return ch
+}
+
+// runStep is what a stubbed collection does: take some time and return an error.
+type runStep struct {
+	duration time.Duration
+	err      error
+}
+
+// newRunCollector returns a collector whose collections follow steps on clock, it cancels ctx once all ran and
+// returns the cutoff of each collection.
+func newRunCollector(client *fakeClient, clock *fakeClock, steps []runStep, cancel context.CancelFunc) (*collector, *recordingStat, *[]time.Time) {
+	stat := &recordingStat{}
+	c := NewCollector(client, stat, nil)
+	c.SetLogger(nil)
+	c.clock = runClock{now: clock.now, after: clock.after, jitter: func(n int64) int64 { return n / 2 }}
+	var cutoffs []time.Time
+	c.collect = func(ctx context.Context, cutoff time.Time, stat statsd.ClientInterface) error {
+		cutoffs = append(cutoffs, cutoff)
+		step := steps[len(cutoffs)-1]
+		clock.advance(step.duration)
+		if len(cutoffs) == len(steps) {
+			cancel()
+		}
+		return step.err
+	}
+	return c, stat, &cutoffs
+}
+
+func TestRunSchedulesAndAdvancesCutoff(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{t: start}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, stat, cutoffs := newRunCollector(&fakeClient{}, clock, []runStep{
+		{duration: time.Minute},
+		{duration: 25 * time.Minute, err: errors.New("sessions unavailable")}, // overruns two starts
+		{duration: time.Minute},
+		{duration: time.Minute},
+	}, cancel)
+
+	err := c.Run(ctx, Config{Username: "u", Password: "p", Interval: 10 * time.Minute, InitialLookback: 30 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDelays := []time.Duration{0, 9 * time.Minute, 5 * time.Minute, 9 * time.Minute, 9 * time.Minute}
+	if len(clock.delays) != len(wantDelays) {
+		t.Fatalf("got delays %v, want %v", clock.delays, wantDelays)
+	}
+	for i, want := range wantDelays {
+		if clock.delays[i] != want {
+			t.Errorf("delay %d: got %s, want %s", i, clock.delays[i], want)
+		}
+	}
+
+	wantCutoffs := []time.Time{
+		start.Add(-30 * time.Minute),
+		start,                       // the first collection succeeded
+		start,                       // the second failed, the cutoff stays
+		start.Add(40 * time.Minute), // the third started after the skipped starts
+	}
+	for i, want := range wantCutoffs {
+		if !(*cutoffs)[i].Equal(want) {
+			t.Errorf("cutoff %d: got %s, want %s", i, (*cutoffs)[i], want)
+		}
+	}
+
+	if overruns := stat.named("fireboard.collect.overrun"); len(overruns) != 1 {
+		t.Errorf("got %d overruns, want 1", len(overruns))
+	}
+	if skipped := stat.named("fireboard.collect.skipped"); len(skipped) != 1 || skipped[0].value != 2 {
+		t.Errorf("got skipped %+v, want 2", skipped)
+	}
+}
+
+func TestRunAddsJitter(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, _ := newRunCollector(&fakeClient{}, clock, []runStep{{}, {}}, cancel)
+	if err := c.Run(ctx, Config{Username: "u", Password: "p", Interval: time.Minute, Jitter: 30 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	// the fake jitter is half the maximum and does not accumulate, each start is 15s after its scheduled time
+	if clock.delays[0] != 15*time.Second || clock.delays[1] != time.Minute {
+		t.Errorf("got delays %v, want 15s then 1m", clock.delays)
+	}
+}
+
+func TestRunDerivesIntervalFromBudget(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)}
+	budget := api.NewRequestBudget(200)
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, _ := newRunCollector(&fakeClient{budget: budget}, clock, []runStep{{}, {}}, cancel)
+	inner := c.collect
+	c.collect = func(ctx context.Context, cutoff time.Time, stat statsd.ClientInterface) error {
+		for i := 0; i < 9; i++ {
+			budget.Take()
+		}
+		return inner(ctx, cutoff, stat)
+	}
+	if err := c.Run(ctx, Config{Username: "u", Password: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	// 9 requests a run within 90% of 200 an hour
+	if got, want := clock.delays[1], budgetInterval(9, 200); got != want || want < 2*time.Minute {
+		t.Errorf("got interval %s, want %s", got, want)
+	}
+	if got := budgetInterval(0, 200); got != minInterval {
+		t.Errorf("idle interval: got %s, want %s", got, minInterval)
+	}
+}
+
+func TestRunRenewsTokenBeforeExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)}
+	client := &fakeClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	// collections start at 0, 20m, 40m, 60m and 80m, the token is renewed 5m before it expires at 60m
+	c, stat, _ := newRunCollector(client, clock, make([]runStep, 5), cancel)
+	if err := c.Run(ctx, Config{Username: "u", Password: "p", Interval: 20 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if client.auths != 2 {
+		t.Errorf("got %d authentications, want 2", client.auths)
+	}
+	for _, sc := range stat.namedChecks("fireboard.can_connect") {
+		if sc.Status != statsd.Ok {
+			t.Errorf("got can_connect %d: %s, want OK", sc.Status, sc.Message)
+		}
+	}
+}
+
+func TestRunReauthenticatesWhenTokenExpired(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)}
+	client := &fakeClient{}
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, cutoffs := newRunCollector(client, clock, []runStep{{err: api.ErrExpiredToken}, {}}, cancel)
+	if err := c.Run(ctx, Config{Username: "u", Password: "p", Interval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if client.auths != 2 || len(*cutoffs) != 2 {
+		t.Errorf("got %d authentications and %d collections, want 2 of each", client.auths, len(*cutoffs))
+	}
+}
+
+func TestRunLetsCollectionFinishOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewCollector(&fakeClient{}, &recordingStat{}, nil)
+	c.SetLogger(nil)
+	started := make(chan struct{})
+	stopped := make(chan time.Duration, 1)
+	c.collect = func(runCtx context.Context, cutoff time.Time, stat statsd.ClientInterface) error {
+		close(started)
+		<-ctx.Done()
+		cancelled := time.Now()
+		<-runCtx.Done()
+		stopped <- time.Since(cancelled)
+		return runCtx.Err()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx, Config{Username: "u", Password: "p", ShutdownTimeout: 50 * time.Millisecond})
+	}()
+	<-started
+	cancel()
+
+	select {
+	case grace := <-stopped:
+		if grace < 40*time.Millisecond {
+			t.Errorf("collection was cancelled after %s, want the 50ms shutdown timeout", grace)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("collection was never cancelled")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+func TestRunRequiresCredentials(t *testing.T) {
+	c := NewCollector(&fakeClient{}, &recordingStat{}, nil)
+	if err := c.Run(context.Background(), Config{}); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+// closingSink is a log sink that records whether it was closed.
+type closingSink struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (s *closingSink) Send(ctx context.Context, records []logs.Record) error {
+	return nil
+}
+
+func (s *closingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestRunClosesLogSinkOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c, _, _ := newRunCollector(&fakeClient{}, &fakeClock{t: time.Now()}, []runStep{{duration: time.Minute}}, cancel)
+	sink := &closingSink{}
+	c.SetLogSink(sink, nil)
+	if err := c.Run(ctx, Config{Username: "u", Password: "p", Interval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if !sink.closed {
+		t.Error("the log sink was not closed")
+	}
+}
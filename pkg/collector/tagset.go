@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"sort"
+)
+
+// TagSet is an immutable, sorted and deduplicated set of statsd tags.
+// With always returns a new set so per-device and per-session tags can never leak into a shared set.
+type TagSet struct {
+	tags []string
+}
+
+// NewTagSet returns a set of the given tags, empty tags are dropped.
+func NewTagSet(tags ...string) TagSet {
+	return TagSet{}.With(tags...)
+}
+
+// With returns a new set containing the tags of t and the given tags.
+func (t TagSet) With(tags ...string) TagSet {
+	merged := make([]string, 0, len(t.tags)+len(tags))
+	merged = append(merged, t.tags...)
+	for _, tag := range tags {
+		if tag != "" {
+			merged = append(merged, tag)
+		}
+	}
+	sort.Strings(merged)
+	out := merged[:0]
+	for i, tag := range merged {
+		if i == 0 || tag != merged[i-1] {
+			out = append(out, tag)
+		}
+	}
+	return TagSet{tags: out[:len(out):len(out)]}
+}
+
+// Tags returns a copy of the tags for a statsd call.
+func (t TagSet) Tags() []string {
+	if len(t.tags) == 0 {
+		return nil
+	}
+	out := make([]string, len(t.tags))
+	copy(out, t.tags)
+	return out
+}
+
+// Len returns the number of tags in the set.
+func (t TagSet) Len() int {
+	return len(t.tags)
+}
+
+// String returns the tags comma separated.
+func (t TagSet) String() string {
+	s := ""
+	for i, tag := range t.tags {
+		if i > 0 {
+			s += ","
+		}
+		s += tag
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagSetSortedAndDeduplicated(t *testing.T) {
+	tags := NewTagSet("env:prod", "app:fireboard", "", "env:prod").Tags()
+	want := []string{"app:fireboard", "env:prod"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("got %v, want %v", tags, want)
+	}
+}
+
+func TestTagSetWithDoesNotModifyParent(t *testing.T) {
+	// extra capacity in the input is what made append(c.tags, ...) alias between devices
+	input := make([]string, 1, 10)
+	input[0] = "env:prod"
+	base := NewTagSet(input...)
+
+	a := base.With("uuid:a")
+	b := base.With("uuid:b")
+
+	if got, want := base.Tags(), []string{"env:prod"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("base changed: got %v, want %v", got, want)
+	}
+	if got, want := a.Tags(), []string{"env:prod", "uuid:a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a: got %v, want %v", got, want)
+	}
+	if got, want := b.Tags(), []string{"env:prod", "uuid:b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("b: got %v, want %v", got, want)
+	}
+}
+
+func TestTagSetTagsReturnsCopy(t *testing.T) {
+	set := NewTagSet("env:prod")
+	tags := set.Tags()
+	tags[0] = "env:dev"
+	if got := set.Tags()[0]; got != "env:prod" {
+		t.Errorf("set was modified through Tags(): %s", got)
+	}
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+// maxTemperatureAge is how old a realtime reading may be before it is considered stale.
+const maxTemperatureAge = time.Minute
+
+// channelLabels maps channel numbers to their configured labels.
+func channelLabels(device api.DevicePropertiesResponse) map[int64]string {
+	labels := make(map[int64]string, len(device.Channels))
+	for _, ch := range device.Channels {
+		labels[ch.Channel] = ch.ChannelLabel
+	}
+	return labels
+}
+
+// withChannel returns tags with the channel number and, when it has one, the channel label.
+func withChannel(tags TagSet, channel int64, label string) TagSet {
+	tags = tags.With(fmt.Sprintf("channel:%d", channel))
+	if label != "" {
+		tags = tags.With("channel_label:" + label)
+	}
+	return tags
+}
+
+// emitTemperatures emits fireboard.channel.temperature in celsius for each channel with a reading in the last minute.
+func (c *collector) emitTemperatures(device api.DevicePropertiesResponse, temps api.RealTimeTemperatureResponse, tags TagSet, stat statsd.ClientInterface) {
+	labels := channelLabels(device)
+	tags = tags.With("device_title:" + device.Title)
+	now := time.Now()
+	for _, t := range temps {
+		if t.Created.IsZero() || now.Sub(t.Created) > maxTemperatureAge {
+			c.logger.Debug("skipping stale channel temperature", "device_uuid", device.UUID, "channel", t.Channel, "created", t.Created)
+			continue
+		}
+		conversion := unity
+		if t.DegreeType == 2 {
+			conversion = fToC
+		}
+		channelTags := withChannel(tags, t.Channel, labels[t.Channel])
+		stat.Gauge("fireboard.channel.temperature", float64(conversion(t.Temp)), channelTags.Tags(), 1.0)
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestCollectEmitsFreshChannelTemperatures(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{{
+			UUID:   "device-a",
+			Title:  "Smoker",
+			Active: true,
+			Channels: []api.ChannelResponse{
+				{Channel: 1, ChannelLabel: "Pit"},
+				{Channel: 2, ChannelLabel: "Brisket"},
+			},
+		}},
+		temps: map[string]api.RealTimeTemperatureResponse{
+			"device-a": {
+				{Channel: 1, Temp: 212, DegreeType: 2, Created: now.Add(-10 * time.Second)},
+				{Channel: 2, Temp: 150, DegreeType: 2, Created: now.Add(-5 * time.Minute)},
+				{Channel: 3, Temp: 20, DegreeType: 1, Created: now},
+			},
+		},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, now)
+
+	temps := stat.named("fireboard.channel.temperature")
+	if len(temps) != 2 {
+		t.Fatalf("got %d temperatures, want 2: %v", len(temps), temps)
+	}
+	want := map[string]float64{"channel:1": 100, "channel:3": 20}
+	for _, m := range temps {
+		channel := m.tagWithPrefix("channel:")
+		if len(channel) != 1 {
+			t.Fatalf("want one channel tag, got %v", m.tags)
+		}
+		if v, ok := want[channel[0]]; !ok || v != m.value {
+			t.Errorf("%s: got %v", channel[0], m.value)
+		}
+		for _, tag := range []string{"uuid:device-a", "device_title:Smoker"} {
+			if !m.hasTag(tag) {
+				t.Errorf("%s: missing %s in %v", channel[0], tag, m.tags)
+			}
+		}
+	}
+	if !temps[0].hasTag("channel_label:Pit") {
+		t.Errorf("channel 1 missing label: %v", temps[0].tags)
+	}
+	if label := temps[1].tagWithPrefix("channel_label:"); len(label) != 0 {
+		t.Errorf("channel 3 has no label, got %v", label)
+	}
+}
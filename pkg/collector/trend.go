@@ -0,0 +1,266 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+const (
+	// defaultRateWindow is how far back channel temperatures are kept for the rate of rise
+	defaultRateWindow = 30 * time.Minute
+	// rateMinSpan is the minimum time between the oldest and newest temperature before a rate of rise is reported
+	rateMinSpan = 5 * time.Minute
+	// rateMinSamples is the minimum number of temperatures before a rate of rise is reported
+	rateMinSamples = 3
+	// rateMaxSamples caps the temperatures kept per channel, the Theil-Sen fit compares every pair of them
+	rateMaxSamples = 120
+	// etaMinRate is the rate of rise in celsius per second below which no eta is reported, a channel in a stall would
+	// otherwise report an eta of days; one degree an hour
+	etaMinRate = 1.0 / 3600
+)
+
+type temperatureSample struct {
+	at      time.Time
+	celsius float64
+}
+
+// temperatureTrends keeps recent realtime and session chart temperatures per device channel across collections.
+type temperatureTrends struct {
+	mu      sync.Mutex
+	samples map[string][]temperatureSample
+}
+
+// add records a sample for the channel, dropping samples older than window and the oldest beyond rateMaxSamples, and
+// returns the samples. A sample with the same time as the newest one is ignored since the channel has not reported since.
+func (t *temperatureTrends) add(key string, sample temperatureSample, window time.Duration) []temperatureSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.samples == nil {
+		t.samples = map[string][]temperatureSample{}
+	}
+	samples := t.samples[key]
+	if n := len(samples); n == 0 || sample.at.After(samples[n-1].at) {
+		samples = append(samples, sample)
+	}
+	oldest := sample.at.Add(-window)
+	for len(samples) > 0 && samples[0].at.Before(oldest) {
+		samples = samples[1:]
+	}
+	if len(samples) > rateMaxSamples {
+		samples = samples[len(samples)-rateMaxSamples:]
+	}
+	t.samples[key] = samples
+	return append([]temperatureSample(nil), samples...)
+}
+
+// seed merges samples from another source, e.g. session chart points, into the channel's samples, keeping those within
+// window of now and at most rateMaxSamples. A sample at the same time as a kept one is ignored.
+func (t *temperatureTrends) seed(key string, seed []temperatureSample, now time.Time, window time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.samples == nil {
+		t.samples = map[string][]temperatureSample{}
+	}
+	oldest := now.Add(-window)
+	seen := map[int64]bool{}
+	var samples []temperatureSample
+	for _, sample := range append(append([]temperatureSample(nil), t.samples[key]...), seed...) {
+		if sample.at.Before(oldest) || seen[sample.at.UnixNano()] {
+			continue
+		}
+		seen[sample.at.UnixNano()] = true
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 {
+		return
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].at.Before(samples[j].at) })
+	if len(samples) > rateMaxSamples {
+		samples = samples[len(samples)-rateMaxSamples:]
+	}
+	t.samples[key] = samples
+}
+
+// evict drops the samples of channels that have not reported since before, e.g. a disabled channel or a removed device.
+func (t *temperatureTrends) evict(before time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, samples := range t.samples {
+		if len(samples) == 0 || samples[len(samples)-1].at.Before(before) {
+			delete(t.samples, key)
+		}
+	}
+}
+
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// theilSen fits a line through the samples with the Theil-Sen estimator, the median of the slopes between every pair
+// of samples, which ignores up to about 29% of outliers such as a probe briefly pulled out of the meat. It returns the
+// slope in degrees per second and the fitted temperature at the newest sample.
+func theilSen(samples []temperatureSample) (slope, newest float64) {
+	origin := samples[0].at
+	slopes := make([]float64, 0, len(samples)*(len(samples)-1)/2)
+	for i := range samples {
+		for j := i + 1; j < len(samples); j++ {
+			dx := samples[j].at.Sub(samples[i].at).Seconds()
+			slopes = append(slopes, (samples[j].celsius-samples[i].celsius)/dx)
+		}
+	}
+	slope = median(slopes)
+	intercepts := make([]float64, len(samples))
+	for i, s := range samples {
+		intercepts[i] = s.celsius - slope*s.at.Sub(origin).Seconds()
+	}
+	return slope, median(intercepts) + slope*samples[len(samples)-1].at.Sub(origin).Seconds()
+}
+
+// ParseChannelTargets parses target temperatures by channel label: comma separated label=temperature with an optional
+// C or F unit, defaulting to C, e.g. "brisket=203F,pit=110C". Labels are matched case insensitively, the targets are
+// returned in celsius.
+func ParseChannelTargets(val string) (map[string]float64, error) {
+	out := map[string]float64{}
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		label, temp, ok := strings.Cut(entry, "=")
+		if !ok || label == "" {
+			return nil, fmt.Errorf("invalid channel target %q, expected label=temperature", entry)
+		}
+		conversion := unity
+		switch {
+		case strings.HasSuffix(strings.ToUpper(temp), "F"):
+			conversion = fToC
+			temp = temp[:len(temp)-1]
+		case strings.HasSuffix(strings.ToUpper(temp), "C"):
+			temp = temp[:len(temp)-1]
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(temp), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid channel target for %s: %w", label, err)
+		}
+		out[strings.ToLower(strings.TrimSpace(label))] = float64(conversion(float32(parsed)))
+	}
+	return out, nil
+}
+
+// NewChannelTargetsFromEnv reads the target temperatures from FIREBOARD_CHANNEL_TARGETS and the rate of rise window
+// from FIREBOARD_RATE_WINDOW, a zero window is the default.
+func NewChannelTargetsFromEnv() (map[string]float64, time.Duration, error) {
+	var window time.Duration
+	if val, ok := os.LookupEnv("FIREBOARD_RATE_WINDOW"); ok && val != "" {
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid FIREBOARD_RATE_WINDOW: %w", err)
+		}
+		window = parsed
+	}
+	targets, err := ParseChannelTargets(os.Getenv("FIREBOARD_CHANNEL_TARGETS"))
+	return targets, window, err
+}
+
+// SetChannelTargets sets the target temperatures in celsius by lower case channel label used for
+// fireboard.channel.eta_seconds, and the window of realtime and chart temperatures the rate of rise is estimated over.
+// A window of zero or less keeps the default.
+func (c *collector) SetChannelTargets(targets map[string]float64, window time.Duration) {
+	if window <= 0 {
+		window = defaultRateWindow
+	}
+	c.channelTargets = targets
+	c.rateWindow = window
+}
+
+// trendKey identifies a device channel in the temperature trends.
+func trendKey(deviceUUID string, channel int64) string {
+	return fmt.Sprintf("%s/%d", deviceUUID, channel)
+}
+
+// channelsByLabel maps each device uuid to its channel numbers by lower case label, to find the channel of a session
+// chart object. Channels without a label are left out.
+func channelsByLabel(devices api.ListDevicesResponse) map[string]map[string]int64 {
+	out := make(map[string]map[string]int64, len(devices))
+	for _, device := range devices {
+		channels := map[string]int64{}
+		for _, ch := range device.Channels {
+			if ch.ChannelLabel != "" {
+				channels[strings.ToLower(ch.ChannelLabel)] = ch.Channel
+			}
+		}
+		out[device.UUID] = channels
+	}
+	return out
+}
+
+// seedChannelTrends adds the session chart points from the rate window to the temperature trends of their device
+// channel, matched by device uuid and channel label, so the next collection can report a rate of rise without
+// waiting for rateMinSamples realtime temperatures.
+func (c *collector) seedChannelTrends(chart api.SessionChartResponse, channels map[string]map[string]int64, now time.Time) {
+	for _, sensor := range chart {
+		channel, ok := channels[sensor.Device][strings.ToLower(sensor.Label)]
+		if !ok {
+			continue
+		}
+		conversion := unity
+		if sensor.DegreeType == 2 {
+			conversion = fToC
+		}
+		var samples []temperatureSample
+		for i := 0; i < len(sensor.X) && i < len(sensor.Y); i++ {
+			samples = append(samples, temperatureSample{at: time.Unix(sensor.X[i], 0), celsius: float64(conversion(sensor.Y[i]))})
+		}
+		c.temperatures.seed(trendKey(sensor.Device, channel), samples, now, c.rateWindow)
+	}
+}
+
+// emitChannelTrends emits fireboard.channel.rate_of_rise in celsius per hour for each channel once its fresh realtime
+// and session chart temperatures span rateMinSpan, and fireboard.channel.eta_seconds for the channels with a target temperature that
+// are rising towards it by at least etaMinRate, or 0 once it is reached.
+func (c *collector) emitChannelTrends(device api.DevicePropertiesResponse, temps api.RealTimeTemperatureResponse, tags TagSet, now time.Time, stat statsd.ClientInterface) {
+	labels := channelLabels(device)
+	tags = tags.With("device_title:" + device.Title)
+	for _, t := range temps {
+		if t.Created.IsZero() || now.Sub(t.Created) > maxTemperatureAge {
+			continue
+		}
+		conversion := unity
+		if t.DegreeType == 2 {
+			conversion = fToC
+		}
+		key := trendKey(device.UUID, t.Channel)
+		samples := c.temperatures.add(key, temperatureSample{at: t.Created, celsius: float64(conversion(t.Temp))}, c.rateWindow)
+		if len(samples) < rateMinSamples || samples[len(samples)-1].at.Sub(samples[0].at) < rateMinSpan {
+			continue
+		}
+		slope, fitted := theilSen(samples)
+		channelTags := withChannel(tags, t.Channel, labels[t.Channel])
+		stat.Gauge("fireboard.channel.rate_of_rise", slope*time.Hour.Seconds(), channelTags.Tags(), 1.0)
+
+		target, ok := c.channelTargets[strings.ToLower(labels[t.Channel])]
+		if !ok {
+			continue
+		}
+		switch {
+		case fitted >= target:
+			stat.Gauge("fireboard.channel.eta_seconds", 0, channelTags.Tags(), 1.0)
+		case slope >= etaMinRate:
+			stat.Gauge("fireboard.channel.eta_seconds", (target-fitted)/slope, channelTags.Tags(), 1.0)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/api"
+)
+
+func TestTheilSenIgnoresOutliers(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	var samples []temperatureSample
+	for i := 0; i <= 10; i++ {
+		celsius := 60 + float64(i) // one degree per minute
+		if i == 4 {
+			celsius = 20 // probe pulled out of the meat
+		}
+		samples = append(samples, temperatureSample{at: start.Add(time.Duration(i) * time.Minute), celsius: celsius})
+	}
+	slope, newest := theilSen(samples)
+	if perHour := slope * 3600; math.Abs(perHour-60) > 0.01 {
+		t.Errorf("slope: got %v per hour, want 60", perHour)
+	}
+	if math.Abs(newest-70) > 0.01 {
+		t.Errorf("fitted newest: got %v, want 70", newest)
+	}
+}
+
+func TestEmitChannelTrends(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	device := api.DevicePropertiesResponse{
+		UUID:     "device-a",
+		Title:    "Smoker",
+		Channels: []api.ChannelResponse{{Channel: 1, ChannelLabel: "Brisket"}, {Channel: 2, ChannelLabel: "Pit"}},
+	}
+	targets, err := ParseChannelTargets("brisket=203F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetChannelTargets(targets, 0)
+
+	var stat *recordingStat
+	for i := 0; i <= 6; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		temps := api.RealTimeTemperatureResponse{
+			// the brisket rises 0.5°F a minute from 190°F, the pit holds at 250°F
+			{Channel: 1, Temp: 190 + float32(i)/2, DegreeType: 2, Created: now.Add(-5 * time.Second)},
+			{Channel: 2, Temp: 250, DegreeType: 2, Created: now.Add(-5 * time.Second)},
+		}
+		stat = &recordingStat{}
+		c.emitChannelTrends(device, temps, NewTagSet("uuid:device-a"), now, stat)
+		if i < 5 && len(stat.metrics) != 0 {
+			t.Fatalf("minute %d: got %+v before the minimum span", i, stat.metrics)
+		}
+	}
+
+	rates := stat.named("fireboard.channel.rate_of_rise")
+	if len(rates) != 2 {
+		t.Fatalf("got %+v, want a rate of rise per channel", rates)
+	}
+	for _, rate := range rates {
+		want := 0.0
+		if rate.hasTag("channel:1") {
+			want = 30 * 5.0 / 9 // 30°F an hour in celsius
+		}
+		if math.Abs(rate.value-want) > 0.01 || !rate.hasTag("device_title:Smoker") {
+			t.Errorf("got rate %v with tags %v, want %v", rate.value, rate.tags, want)
+		}
+	}
+
+	etas := stat.named("fireboard.channel.eta_seconds")
+	if len(etas) != 1 || !etas[0].hasTag("channel_label:Brisket") {
+		t.Fatalf("got %+v, want an eta for the brisket only", etas)
+	}
+	// 10°F left at 0.5°F a minute
+	if want := (20 * time.Minute).Seconds(); math.Abs(etas[0].value-want) > 1 {
+		t.Errorf("eta: got %v, want %v", etas[0].value, want)
+	}
+}
+
+func TestParseChannelTargets(t *testing.T) {
+	targets, err := ParseChannelTargets(" Brisket=203F, pit=110c,ribs=95")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"brisket": 95, "pit": 110, "ribs": 95}
+	for label, temp := range want {
+		if math.Abs(targets[label]-temp) > 0.001 {
+			t.Errorf("%s: got %v, want %v", label, targets[label], temp)
+		}
+	}
+	for _, val := range []string{"brisket", "=203", "brisket=hot"} {
+		if _, err := ParseChannelTargets(val); err == nil {
+			t.Errorf("%q: expected an error", val)
+		}
+	}
+}
+
+func TestEmitChannelTrendsSkipsEtaInStall(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	device := api.DevicePropertiesResponse{UUID: "device-a", Channels: []api.ChannelResponse{{Channel: 1, ChannelLabel: "Brisket"}}}
+	c := NewCollector(&fakeClient{}, nil, nil)
+	c.SetChannelTargets(map[string]float64{"brisket": 95}, 0)
+
+	var stat *recordingStat
+	for i := 0; i <= 10; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		// stalled at 70°C, creeping up half a degree an hour
+		temps := api.RealTimeTemperatureResponse{{Channel: 1, Temp: 70 + float32(i)/120, Created: now}}
+		stat = &recordingStat{}
+		c.emitChannelTrends(device, temps, NewTagSet(), now, stat)
+	}
+	if rates := stat.named("fireboard.channel.rate_of_rise"); len(rates) != 1 {
+		t.Fatalf("got %+v, want the rate of rise", rates)
+	}
+	if etas := stat.named("fireboard.channel.eta_seconds"); len(etas) != 0 {
+		t.Errorf("got %+v, want no eta below the minimum rate", etas)
+	}
+}
+
+func TestTemperatureTrendsCapsAndEvictsSamples(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	var trends temperatureTrends
+	var samples []temperatureSample
+	for i := 0; i < rateMaxSamples+10; i++ {
+		samples = trends.add("device-a/1", temperatureSample{at: start.Add(time.Duration(i) * time.Second), celsius: 20}, time.Hour)
+	}
+	if len(samples) != rateMaxSamples || !samples[0].at.Equal(start.Add(10*time.Second)) {
+		t.Errorf("got %d samples from %s, want the newest %d", len(samples), samples[0].at, rateMaxSamples)
+	}
+
+	trends.add("device-b/1", temperatureSample{at: start.Add(time.Hour), celsius: 20}, time.Hour)
+	trends.evict(start.Add(30 * time.Minute))
+	if _, ok := trends.samples["device-a/1"]; ok {
+		t.Error("the channel that stopped reporting was kept")
+	}
+	if _, ok := trends.samples["device-b/1"]; !ok {
+		t.Error("the reporting channel was evicted")
+	}
+}
+
+func TestCollectSeedsChannelTrendsFromSessionChart(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	chart := api.SessionChartObject{Label: "brisket", Device: "device-a", ChannelID: "1"}
+	for i := 10; i > 0; i-- {
+		// one degree a minute up to 80°C a minute ago
+		chart.X = append(chart.X, now.Add(-time.Duration(i)*time.Minute).Unix())
+		chart.Y = append(chart.Y, float32(81-i))
+	}
+	client := &fakeClient{
+		devices: api.ListDevicesResponse{{
+			UUID:     "device-a",
+			Active:   true,
+			Channels: []api.ChannelResponse{{Channel: 1, ChannelLabel: "Brisket"}, {Channel: 2}},
+		}},
+		temps: map[string]api.RealTimeTemperatureResponse{
+			"device-a": {{Channel: 1, Temp: 81, Created: now}, {Channel: 2, Temp: 20, Created: now}},
+		},
+		sessions: api.SessionsListResponse{{ID: 1, EndTime: now.Add(time.Hour)}},
+		charts:   map[int64]api.SessionChartResponse{1: {chart}},
+	}
+	c, stat := newTestCollector(client)
+	mustCollect(t, c, now.Add(-time.Hour))
+	if rates := stat.named("fireboard.channel.rate_of_rise"); len(rates) != 0 {
+		t.Fatalf("got %+v, want no rate of rise from a single realtime temperature", rates)
+	}
+
+	// the next collection fits the chart points and the new realtime temperature
+	stat.metrics = nil
+	client.temps["device-a"] = api.RealTimeTemperatureResponse{{Channel: 1, Temp: 81, Created: now.Add(time.Second)}}
+	mustCollect(t, c, now)
+	rates := stat.named("fireboard.channel.rate_of_rise")
+	if len(rates) != 1 || !rates[0].hasTag("channel:1") {
+		t.Fatalf("got %+v, want a rate of rise for the brisket", rates)
+	}
+	if math.Abs(rates[0].value-60) > 1 {
+		t.Errorf("got %v per hour, want about 60", rates[0].value)
+	}
+}
@@ -0,0 +1,54 @@
+package intake
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultSite is the Datadog site used when none is configured
+const DefaultSite = "datadoghq.com"
+
+// maxResponseSize is the most of a response body that is read
+const maxResponseSize = 64 << 10
+
+// Post sends payload as gzip compressed json to a Datadog http intake at url, authenticated with apiKey. It returns
+// the body of a 2xx response, an error naming the intake for any other status.
+func Post(ctx context.Context, client *http.Client, url, apiKey, name string, payload interface{}) ([]byte, error) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	if err := json.NewEncoder(zw).Encode(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("DD-API-KEY", apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, name, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,54 @@
+package intake
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostSendsGzipJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v2/test" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		for header, want := range map[string]string{"DD-API-KEY": "test-key", "Content-Encoding": "gzip", "Content-Type": "application/json"} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("%s: got %q, want %q", header, got, want)
+			}
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatalf("body is not gzip: %v", err)
+		}
+		var got map[string]string
+		if err := json.NewDecoder(zr).Decode(&got); err != nil || got["hello"] != "world" {
+			t.Errorf("got body %v (%v)", got, err)
+		}
+		w.Write([]byte(`{"errors":[]}`))
+	}))
+	defer server.Close()
+
+	data, err := Post(context.Background(), server.Client(), server.URL+"/api/v2/test", "test-key", "test intake", map[string]string{"hello": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"errors":[]}` {
+		t.Errorf("got response %s", data)
+	}
+}
+
+func TestPostReturnsStatusErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("invalid api key\n"))
+	}))
+	defer server.Close()
+
+	_, err := Post(context.Background(), server.Client(), server.URL, "bad-key", "test intake", []int{1})
+	if err == nil || err.Error() != "unexpected status 403 from test intake: invalid api key" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/intake"
+)
+
+const (
+	// DefaultSite is the Datadog site used when none is configured
+	DefaultSite = intake.DefaultSite
+
+	// SinkStdout writes json lines to stdout
+	SinkStdout = "stdout"
+	// SinkFile appends json lines to a file, e.g. one tailed by the Datadog Agent
+	SinkFile = "file"
+	// SinkHTTP submits to the Datadog logs http intake
+	SinkHTTP = "http"
+
+	logsAPIPath    = "/api/v2/logs"
+	defaultTimeout = 30 * time.Second
+	source         = "fireboard"
+	service        = "fireboard-datadog-integration"
+	redacted       = "REDACTED"
+)
+
+// DefaultRedactedFields are the device log fields redacted unless configured otherwise: addresses that identify a home network.
+var DefaultRedactedFields = []string{"internalIP", "publicIP", "macNIC", "macAP", "bleClientMAC", "ssid"}
+
+// Record is a single structured log.
+type Record struct {
+	Timestamp  time.Time
+	Message    string
+	Tags       []string
+	Attributes map[string]interface{}
+}
+
+// MarshalJSON encodes the record in the Datadog log format, attributes are merged into the top level object.
+func (r Record) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(r.Attributes)+5)
+	for k, v := range r.Attributes {
+		out[k] = v
+	}
+	out["timestamp"] = r.Timestamp.UTC().Format(time.RFC3339)
+	out["message"] = r.Message
+	out["ddsource"] = source
+	out["service"] = service
+	if len(r.Tags) > 0 {
+		out["ddtags"] = strings.Join(r.Tags, ",")
+	}
+	return json.Marshal(out)
+}
+
+// Sink sends structured logs.
+type Sink interface {
+	Send(ctx context.Context, records []Record) error
+	// Close releases the sink's file or connections, no records may be sent after.
+	Close() error
+}
+
+// Redact replaces the values of fields in attrs, it returns a copy and leaves attrs unchanged.
+func Redact(attrs map[string]interface{}, fields []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		out[k] = v
+	}
+	for _, f := range fields {
+		if v, ok := out[f]; ok && v != "" {
+			out[f] = redacted
+		}
+	}
+	return out
+}
+
+type writerSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // the file opened by NewFileSink, nil for a writer owned by the caller
+}
+
+// NewWriterSink returns a sink writing each record as a line of json to w, closing the sink leaves w open.
+func NewWriterSink(w io.Writer) *writerSink {
+	return &writerSink{w: w}
+}
+
+// NewFileSink returns a sink appending json lines to the file at path, creating it if needed. Closing the sink closes
+// the file.
+func NewFileSink(path string) (*writerSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{w: f, closer: f}, nil
+}
+
+func (s *writerSink) Send(ctx context.Context, records []Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enc := json.NewEncoder(s.w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closer == nil {
+		return nil
+	}
+	err := s.closer.Close()
+	s.closer = nil
+	return err
+}
+
+type httpSink struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewHTTPSink returns a sink submitting to the Datadog logs http intake of site, e.g. datadoghq.com or datadoghq.eu.
+func NewHTTPSink(apiKey, site string) *httpSink {
+	if site == "" {
+		site = DefaultSite
+	}
+	return &httpSink{
+		baseURL:    "https://http-intake.logs." + site,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// SetBaseURL overrides the url derived from the site, e.g. to submit through a proxy.
+func (s *httpSink) SetBaseURL(url string) {
+	s.baseURL = strings.TrimSuffix(url, "/")
+}
+
+// GetBaseURL returns the url logs are submitted to.
+func (s *httpSink) GetBaseURL() string {
+	return s.baseURL
+}
+
+func (s *httpSink) Send(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	_, err := intake.Post(ctx, s.httpClient, s.baseURL+logsAPIPath, s.apiKey, "logs intake", records)
+	return err
+}
+
+func (s *httpSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// NewSinkFromEnv returns the sink selected by FIREBOARD_LOGS_SINK, one of the Sink* constants, or nil if it is not set.
+// The file sink writes to FIREBOARD_LOGS_FILE, the http sink uses DD_API_KEY, DD_SITE and FIREBOARD_LOGS_URL.
+func NewSinkFromEnv() (Sink, error) {
+	switch kind := os.Getenv("FIREBOARD_LOGS_SINK"); kind {
+	case "":
+		return nil, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	case SinkFile:
+		path := os.Getenv("FIREBOARD_LOGS_FILE")
+		if path == "" {
+			return nil, errors.New("FIREBOARD_LOGS_FILE is required for the file logs sink")
+		}
+		sink, err := NewFileSink(path)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case SinkHTTP:
+		apiKey := os.Getenv("DD_API_KEY")
+		if apiKey == "" {
+			return nil, errors.New("DD_API_KEY is required for the http logs sink")
+		}
+		sink := NewHTTPSink(apiKey, os.Getenv("DD_SITE"))
+		if val, ok := os.LookupEnv("FIREBOARD_LOGS_URL"); ok && val != "" {
+			sink.SetBaseURL(val)
+		}
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown logs sink: %q", kind)
+	}
+}
+
+// RedactedFieldsFromEnv returns the comma separated fields in FIREBOARD_LOGS_REDACT, or DefaultRedactedFields if it is not set.
+// An empty value disables redaction.
+func RedactedFieldsFromEnv() []string {
+	val, ok := os.LookupEnv("FIREBOARD_LOGS_REDACT")
+	if !ok {
+		return DefaultRedactedFields
+	}
+	var fields []string
+	for _, f := range strings.Split(val, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
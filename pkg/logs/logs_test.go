@@ -0,0 +1,145 @@
+package logs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecord() Record {
+	return Record{
+		Timestamp:  time.Date(2022, 9, 1, 0, 36, 11, 0, time.UTC),
+		Message:    "FireBoard device log for Smoker",
+		Tags:       []string{"env:test", "uuid:device-a"},
+		Attributes: map[string]interface{}{"device_uuid": "device-a"},
+	}
+}
+
+func TestWriterSinkWritesJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewWriterSink(&out).Send(context.Background(), []Record{testRecord(), testRecord()}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), out.String())
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"timestamp":   "2022-09-01T00:36:11Z",
+		"message":     "FireBoard device log for Smoker",
+		"ddsource":    "fireboard",
+		"service":     "fireboard-datadog-integration",
+		"ddtags":      "env:test,uuid:device-a",
+		"device_uuid": "device-a",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestHTTPSinkSubmitsGzipBatch(t *testing.T) {
+	var received []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != logsAPIPath || r.Header.Get("DD-API-KEY") != "test-key" || r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			return
+		}
+		if err := json.NewDecoder(zr).Decode(&received); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink("test-key", "")
+	sink.SetBaseURL(server.URL)
+	if err := sink.Send(context.Background(), []Record{testRecord()}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0]["device_uuid"] != "device-a" {
+		t.Errorf("got %v", received)
+	}
+}
+
+func TestHTTPSinkReturnsIntakeErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink("test-key", "")
+	sink.SetBaseURL(server.URL)
+	if err := sink.Send(context.Background(), []Record{testRecord()}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want a 403 error", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	attrs := map[string]interface{}{"publicIP": "8.8.8.8", "ssid": "", "model": "FBX2"}
+	got := Redact(attrs, []string{"publicIP", "ssid", "missing"})
+	if got["publicIP"] != redacted || got["ssid"] != "" || got["model"] != "FBX2" {
+		t.Errorf("got %v", got)
+	}
+	if _, ok := got["missing"]; ok {
+		t.Error("redacting a missing field added it")
+	}
+	if attrs["publicIP"] != "8.8.8.8" {
+		t.Error("input was modified")
+	}
+}
+
+func TestFileSinkClosesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "device.log")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(context.Background(), []Record{testRecord()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(context.Background(), []Record{testRecord()}); err == nil {
+		t.Error("sent to a closed file")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("got %d lines, want 1", lines)
+	}
+}
+
+func TestWriterSinkCloseLeavesWriterOpen(t *testing.T) {
+	var out bytes.Buffer
+	sink := NewWriterSink(&out)
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(context.Background(), []Record{testRecord()}); err != nil {
+		t.Errorf("the writer was closed: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Notifier delivers rule notifications.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+type multiNotifier []Notifier
+
+// MultiNotifier returns a notifier delivering to every notifier, it returns the errors of all that failed.
+func MultiNotifier(notifiers ...Notifier) Notifier {
+	return multiNotifier(notifiers)
+}
+
+func (m multiNotifier) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type webhookNotifier struct {
+	url        string
+	headers    http.Header
+	httpClient *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting each notification as json to url.
+func NewWebhookNotifier(url string) *webhookNotifier {
+	return &webhookNotifier{
+		url:        url,
+		headers:    http.Header{},
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// SetHeader sets a header sent with every request, e.g. an authorization token.
+func (w *webhookNotifier) SetHeader(key, value string) {
+	w.headers.Set(key, value)
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range w.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("unexpected status %d from webhook: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+type smtpNotifier struct {
+	addr    string
+	from    string
+	to      []string
+	auth    smtp.Auth
+	timeout time.Duration
+}
+
+// NewSMTPNotifier returns a notifier emailing each notification from from to the to addresses through the server at
+// addr, a host:port. STARTTLS is used when the server offers it.
+func NewSMTPNotifier(addr, from string, to []string) *smtpNotifier {
+	return &smtpNotifier{addr: addr, from: from, to: to, timeout: defaultTimeout}
+}
+
+// SetAuth authenticates with PLAIN auth, which the server must offer over TLS unless it runs on localhost.
+func (s *smtpNotifier) SetAuth(username, password string) {
+	host, _, _ := net.SplitHostPort(s.addr)
+	s.auth = smtp.PlainAuth("", username, password, host)
+}
+
+// SetTimeout sets how long delivering a notification may take, including connecting to the server.
+func (s *smtpNotifier) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, n Notification) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: [FireBoard %s] %s\r\n", n.Status, n.Rule)
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(n.Message + "\r\n")
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{Timeout: s.timeout}).DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// every read and write on the connection fails once the context is done, so a hung server cannot block delivery
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if err := client.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// NewNotifierFromEnv returns the notifiers configured in the environment, or nil if none are:
+// a webhook posting to FIREBOARD_RULES_WEBHOOK_URL, and an email sent through FIREBOARD_SMTP_ADDR from
+// FIREBOARD_SMTP_FROM to the comma separated FIREBOARD_SMTP_TO, authenticating with FIREBOARD_SMTP_USERNAME and
+// FIREBOARD_SMTP_PASSWORD when set.
+func NewNotifierFromEnv() (Notifier, error) {
+	var notifiers []Notifier
+	if url := os.Getenv("FIREBOARD_RULES_WEBHOOK_URL"); url != "" {
+		notifiers = append(notifiers, NewWebhookNotifier(url))
+	}
+	if addr := os.Getenv("FIREBOARD_SMTP_ADDR"); addr != "" {
+		from := os.Getenv("FIREBOARD_SMTP_FROM")
+		var to []string
+		for _, addr := range strings.Split(os.Getenv("FIREBOARD_SMTP_TO"), ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		if from == "" || len(to) == 0 {
+			return nil, errors.New("FIREBOARD_SMTP_FROM and FIREBOARD_SMTP_TO are required with FIREBOARD_SMTP_ADDR")
+		}
+		notifier := NewSMTPNotifier(addr, from, to)
+		if username, ok := os.LookupEnv("FIREBOARD_SMTP_USERNAME"); ok && username != "" {
+			notifier.SetAuth(username, os.Getenv("FIREBOARD_SMTP_PASSWORD"))
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	switch len(notifiers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return notifiers[0], nil
+	default:
+		return MultiNotifier(notifiers...), nil
+	}
+}
@@ -0,0 +1,205 @@
+package rules
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNotification = Notification{
+	Rule:        "brisket done",
+	Status:      StatusFiring,
+	DeviceUUID:  "device-a",
+	DeviceTitle: "Smoker",
+	Channel:     2,
+	Label:       "brisket",
+	Value:       203.4,
+	Unit:        "F",
+	Time:        time.Date(2022, 9, 1, 0, 35, 58, 0, time.UTC),
+	Message:     "brisket done: brisket on Smoker is 203.4°F and is at or above 203.0°F",
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notification
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL)
+	notifier.SetHeader("Authorization", "Bearer token")
+	if err := notifier.Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	if got != testNotification {
+		t.Errorf("got %+v, want %+v", got, testNotification)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("authorization header: got %q", auth)
+	}
+}
+
+func TestWebhookNotifierStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), testNotification)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("got %v, want a 502 error", err)
+	}
+}
+
+// serveSMTP accepts a single smtp session on l and sends the recipients and message it received on messages.
+func serveSMTP(t *testing.T, l net.Listener, messages chan<- []string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var received []string
+	reply("220 localhost ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); {
+		case cmd == "EHLO" || cmd == "HELO":
+			reply("250 localhost")
+		case cmd == "MAIL":
+			reply("250 ok")
+		case cmd == "RCPT":
+			received = append(received, line)
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				data = strings.TrimRight(data, "\r\n")
+				if data == "." {
+					break
+				}
+				received = append(received, data)
+			}
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			messages <- received
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	messages := make(chan []string, 1)
+	go serveSMTP(t, l, messages)
+
+	notifier := NewSMTPNotifier(l.Addr().String(), "fireboard@example.com", []string{"pitmaster@example.com"})
+	if err := notifier.Notify(context.Background(), testNotification); err != nil {
+		t.Fatal(err)
+	}
+	received := strings.Join(<-messages, "\n")
+	for _, want := range []string{
+		"RCPT TO:<pitmaster@example.com>",
+		"Subject: [FireBoard firing] brisket done",
+		testNotification.Message,
+	} {
+		if !strings.Contains(received, want) {
+			t.Errorf("message is missing %q:\n%s", want, received)
+		}
+	}
+}
+
+func TestNewNotifierFromEnv(t *testing.T) {
+	t.Setenv("FIREBOARD_RULES_WEBHOOK_URL", "")
+	t.Setenv("FIREBOARD_SMTP_ADDR", "")
+	if notifier, err := NewNotifierFromEnv(); notifier != nil || err != nil {
+		t.Errorf("unset: got %v, %v", notifier, err)
+	}
+
+	t.Setenv("FIREBOARD_SMTP_ADDR", "localhost:25")
+	if _, err := NewNotifierFromEnv(); err == nil {
+		t.Error("expected an error without FIREBOARD_SMTP_FROM and FIREBOARD_SMTP_TO")
+	}
+
+	t.Setenv("FIREBOARD_SMTP_FROM", "fireboard@example.com")
+	t.Setenv("FIREBOARD_SMTP_TO", "a@example.com, b@example.com")
+	t.Setenv("FIREBOARD_RULES_WEBHOOK_URL", "http://localhost/hook")
+	notifier, err := NewNotifierFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, ok := notifier.(multiNotifier)
+	if !ok || len(multi) != 2 {
+		t.Fatalf("got %#v, want both notifiers", notifier)
+	}
+	if to := multi[1].(*smtpNotifier).to; len(to) != 2 || to[1] != "b@example.com" {
+		t.Errorf("recipients: got %v", to)
+	}
+}
+
+func TestSMTPNotifierTimesOutOnHungServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		// accept connections and never send the greeting
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	notifier := NewSMTPNotifier(l.Addr().String(), "fireboard@example.com", []string{"pitmaster@example.com"})
+	notifier.SetTimeout(50 * time.Millisecond)
+	start := time.Now()
+	if err := notifier.Notify(context.Background(), testNotification); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %s, want the 50ms timeout", elapsed)
+	}
+
+	notifier.SetTimeout(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	if err := notifier.Notify(ctx, testNotification); err == nil {
+		t.Fatal("expected an error once the context is cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("took %s after the context was cancelled", elapsed)
+	}
+}
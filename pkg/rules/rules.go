@@ -0,0 +1,293 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// StatusFiring is the status of a notification sent when a rule fires
+	StatusFiring = "firing"
+	// StatusResolved is the status of a notification sent when a firing rule resolves
+	StatusResolved = "resolved"
+)
+
+// Duration is a time.Duration decoded from a json string such as "10m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule fires when a channel's temperature is at or above Above, or at or below Below, for at least For.
+// A pit that must stay within 225-275°F is {"below": 225, "above": 275, "unit": "F"}, a probe reaching 203°F is
+// {"above": 203, "unit": "F"}.
+type Rule struct {
+	Name       string   `json:"name"`                 // unique name of the rule, required
+	Device     string   `json:"device,omitempty"`     // device uuid or title, empty matches every device
+	Channel    string   `json:"channel,omitempty"`    // channel label or number, empty matches every channel
+	Unit       string   `json:"unit,omitempty"`       // unit of Above, Below and Hysteresis: C or F, defaults to C
+	Above      *float64 `json:"above,omitempty"`      // fires at or above this temperature
+	Below      *float64 `json:"below,omitempty"`      // fires at or below this temperature
+	For        Duration `json:"for,omitempty"`        // how long the temperature must be out of bounds before firing
+	Hysteresis float64  `json:"hysteresis,omitempty"` // degrees back within bounds needed to resolve
+	Cooldown   Duration `json:"cooldown,omitempty"`   // minimum time between two firings
+}
+
+// celsius converts a temperature or, if delta, a temperature difference in the rule's unit to celsius.
+func (r Rule) celsius(v float64, delta bool) float64 {
+	if !strings.EqualFold(r.Unit, "F") {
+		return v
+	}
+	if delta {
+		return v * 5 / 9
+	}
+	return (v - 32) * 5 / 9
+}
+
+// validate returns an error if the rule can never fire or is misconfigured.
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return errors.New("rule name is required")
+	}
+	if r.Above == nil && r.Below == nil {
+		return fmt.Errorf("rule %q needs above or below", r.Name)
+	}
+	switch strings.ToUpper(r.Unit) {
+	case "", "C", "F":
+	default:
+		return fmt.Errorf("rule %q has unknown unit %q, expected C or F", r.Name, r.Unit)
+	}
+	if r.Hysteresis < 0 || r.For < 0 || r.Cooldown < 0 {
+		return fmt.Errorf("rule %q has a negative hysteresis, for or cooldown", r.Name)
+	}
+	return nil
+}
+
+// matches returns true if the rule applies to the reading.
+func (r Rule) matches(reading Reading) bool {
+	if r.Device != "" && r.Device != reading.DeviceUUID && !strings.EqualFold(r.Device, reading.DeviceTitle) {
+		return false
+	}
+	if r.Channel != "" && r.Channel != strconv.FormatInt(reading.Channel, 10) && !strings.EqualFold(r.Channel, reading.Label) {
+		return false
+	}
+	return true
+}
+
+// LoadRules reads a json array of rules from path.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Reading is a channel temperature in celsius.
+type Reading struct {
+	DeviceUUID  string
+	DeviceTitle string
+	Channel     int64
+	Label       string
+	Celsius     float64
+	Time        time.Time
+}
+
+// Notification is sent to a Notifier when a rule fires or resolves.
+type Notification struct {
+	Rule        string    `json:"rule"`
+	Status      string    `json:"status"` // StatusFiring or StatusResolved
+	DeviceUUID  string    `json:"device_uuid"`
+	DeviceTitle string    `json:"device_title"`
+	Channel     int64     `json:"channel"`
+	Label       string    `json:"channel_label"`
+	Value       float64   `json:"value"` // the temperature in the rule's unit
+	Unit        string    `json:"unit"`
+	Time        time.Time `json:"time"`
+	Message     string    `json:"message"`
+}
+
+// ruleState is the state of a rule for a single channel.
+type ruleState struct {
+	breachedAt time.Time       // when the temperature went out of bounds, zero while in bounds
+	deliveries []deliveryState // per notifier, in the engine's notifier order
+}
+
+// deliveryState is the state of a rule as delivered to a single notifier.
+type deliveryState struct {
+	firing  bool
+	firedAt time.Time // when the rule last fired
+}
+
+// Engine evaluates rules against readings, keeping state per rule and channel across evaluations.
+type Engine struct {
+	rules     []Rule
+	notifiers []Notifier
+
+	mu     sync.Mutex
+	states map[string]*ruleState
+}
+
+// NewEngine validates the rules and returns an engine sending notifications to notifier. The notifiers of a
+// MultiNotifier are tracked separately, so one that fails does not make the others deliver a notification again.
+func NewEngine(rules []Rule, notifier Notifier) (*Engine, error) {
+	names := map[string]bool{}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+	}
+	notifiers, ok := notifier.(multiNotifier)
+	if !ok {
+		notifiers = multiNotifier{notifier}
+	}
+	return &Engine{rules: rules, notifiers: notifiers, states: map[string]*ruleState{}}, nil
+}
+
+// Evaluate checks the readings against every matching rule and notifies on each rule that fires or resolves.
+// A rule fires once its channel has been out of bounds for the rule's For duration and it has not fired within its
+// cooldown. It resolves once the channel is back within bounds by at least the rule's hysteresis.
+// A rule only changes state for a notifier once its notification was delivered to it, a failed notification is sent
+// again to that notifier by the next evaluation that still fires or resolves the rule. Evaluate is safe for concurrent
+// use, it returns the errors of the notifications that failed.
+func (e *Engine) Evaluate(ctx context.Context, readings []Reading) error {
+	var transitions []transition
+	e.mu.Lock()
+	for _, reading := range readings {
+		for _, rule := range e.rules {
+			if !rule.matches(reading) {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s/%d", rule.Name, reading.DeviceUUID, reading.Channel)
+			transitions = append(transitions, e.evaluate(key, rule, reading)...)
+		}
+	}
+	e.mu.Unlock()
+
+	var errs []error
+	for _, t := range transitions {
+		if err := e.notifiers[t.notifier].Notify(ctx, t.n); err != nil {
+			errs = append(errs, fmt.Errorf("notify %s %s: %w", t.n.Rule, t.n.Status, err))
+			continue
+		}
+		e.mu.Lock()
+		delivery := &e.states[t.key].deliveries[t.notifier]
+		delivery.firing = t.n.Status == StatusFiring
+		if delivery.firing {
+			delivery.firedAt = t.n.Time
+		}
+		e.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// transition is a notification to deliver to the notifier at the index.
+type transition struct {
+	key      string
+	notifier int
+	n        Notification
+}
+
+// evaluate tracks how long the rule has been breached for the reading and returns a transition for every notifier
+// the rule fires or resolves for. The rule's firing state is left to the caller once the notification is delivered.
+func (e *Engine) evaluate(key string, rule Rule, reading Reading) []transition {
+	state, ok := e.states[key]
+	if !ok {
+		state = &ruleState{deliveries: make([]deliveryState, len(e.notifiers))}
+		e.states[key] = state
+	}
+	temp := reading.Celsius
+	hysteresis := rule.celsius(rule.Hysteresis, true)
+	above := rule.Above != nil && temp >= rule.celsius(*rule.Above, false)
+	below := rule.Below != nil && temp <= rule.celsius(*rule.Below, false)
+	cleared := (rule.Above == nil || temp < rule.celsius(*rule.Above, false)-hysteresis) &&
+		(rule.Below == nil || temp > rule.celsius(*rule.Below, false)+hysteresis)
+
+	if !above && !below {
+		state.breachedAt = time.Time{}
+	} else if state.breachedAt.IsZero() {
+		state.breachedAt = reading.Time
+	}
+
+	var out []transition
+	for i, delivery := range state.deliveries {
+		switch {
+		case delivery.firing && cleared:
+			out = append(out, transition{key, i, e.notification(rule, reading, StatusResolved, "is back within bounds")})
+		case !delivery.firing && (above || below):
+			if reading.Time.Sub(state.breachedAt) < time.Duration(rule.For) {
+				continue
+			}
+			if !delivery.firedAt.IsZero() && reading.Time.Sub(delivery.firedAt) < time.Duration(rule.Cooldown) {
+				continue
+			}
+			direction := "at or above"
+			threshold := rule.Above
+			if below {
+				direction = "at or below"
+				threshold = rule.Below
+			}
+			out = append(out, transition{key, i, e.notification(rule, reading, StatusFiring, fmt.Sprintf("is %s %.1f°%s", direction, *threshold, rule.unit()))})
+		}
+	}
+	return out
+}
+
+func (r Rule) unit() string {
+	if strings.EqualFold(r.Unit, "F") {
+		return "F"
+	}
+	return "C"
+}
+
+func (e *Engine) notification(rule Rule, reading Reading, status, detail string) Notification {
+	value := reading.Celsius
+	if rule.unit() == "F" {
+		value = value*9/5 + 32
+	}
+	name := reading.Label
+	if name == "" {
+		name = fmt.Sprintf("channel %d", reading.Channel)
+	}
+	return Notification{
+		Rule:        rule.Name,
+		Status:      status,
+		DeviceUUID:  reading.DeviceUUID,
+		DeviceTitle: reading.DeviceTitle,
+		Channel:     reading.Channel,
+		Label:       reading.Label,
+		Value:       value,
+		Unit:        rule.unit(),
+		Time:        reading.Time,
+		Message:     fmt.Sprintf("%s: %s on %s is %.1f°%s and %s", rule.Name, name, reading.DeviceTitle, value, rule.unit(), detail),
+	}
+}
@@ -0,0 +1,241 @@
+package rules
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	notifications []Notification
+	err           error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r.notifications = append(r.notifications, n)
+	return r.err
+}
+
+func (r *recordingNotifier) statuses() []string {
+	var statuses []string
+	for _, n := range r.notifications {
+		statuses = append(statuses, n.Status)
+	}
+	return statuses
+}
+
+func fToC(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestEngineRangeRuleWithHysteresisAndCooldown(t *testing.T) {
+	notifier := &recordingNotifier{}
+	engine, err := NewEngine([]Rule{{
+		Name:       "pit",
+		Device:     "Smoker",
+		Channel:    "Pit",
+		Unit:       "F",
+		Below:      float(225),
+		Above:      float(275),
+		For:        Duration(10 * time.Minute),
+		Hysteresis: 5,
+		Cooldown:   Duration(time.Hour),
+	}}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	steps := []struct {
+		minutes int
+		temp    float64
+		want    []string
+	}{
+		{0, 250, nil},
+		{1, 280, nil},                     // out of range, pending
+		{6, 250, nil},                     // back in range before 10 minutes, pending resets
+		{7, 280, nil},                     // out of range again
+		{17, 281, []string{StatusFiring}}, // 10 minutes out of range
+		{18, 282, []string{StatusFiring}}, // still firing, no repeat
+		{19, 272, []string{StatusFiring}}, // within range but not by the hysteresis
+		{20, 268, []string{StatusFiring, StatusResolved}},
+		{21, 290, []string{StatusFiring, StatusResolved}},
+		{40, 290, []string{StatusFiring, StatusResolved}}, // out of range long enough but within the cooldown
+		{78, 290, []string{StatusFiring, StatusResolved, StatusFiring}},
+	}
+	for _, step := range steps {
+		reading := Reading{DeviceUUID: "device-a", DeviceTitle: "smoker", Channel: 1, Label: "pit", Celsius: fToC(step.temp), Time: start.Add(time.Duration(step.minutes) * time.Minute)}
+		if err := engine.Evaluate(context.Background(), []Reading{reading}); err != nil {
+			t.Fatal(err)
+		}
+		if got := notifier.statuses(); len(got) != len(step.want) {
+			t.Fatalf("minute %d at %.0f°F: got %v, want %v", step.minutes, step.temp, got, step.want)
+		}
+	}
+
+	n := notifier.notifications[0]
+	if n.Rule != "pit" || n.Unit != "F" || n.DeviceUUID != "device-a" || n.Channel != 1 {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+	if n.Value < 280.9 || n.Value > 281.1 {
+		t.Errorf("value in the rule's unit: got %v, want 281", n.Value)
+	}
+}
+
+func TestEngineTargetRuleMatchesOnlyItsChannel(t *testing.T) {
+	notifier := &recordingNotifier{}
+	engine, err := NewEngine([]Rule{{Name: "brisket done", Channel: "2", Unit: "F", Above: float(203)}}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	readings := []Reading{
+		{DeviceUUID: "device-a", Channel: 1, Label: "pit", Celsius: fToC(250), Time: now},
+		{DeviceUUID: "device-a", Channel: 2, Label: "brisket", Celsius: fToC(203), Time: now},
+		{DeviceUUID: "device-b", Channel: 2, Label: "ribs", Celsius: fToC(190), Time: now},
+	}
+	if err := engine.Evaluate(context.Background(), readings); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.notifications) != 1 {
+		t.Fatalf("got %+v, want one notification", notifier.notifications)
+	}
+	if n := notifier.notifications[0]; n.Status != StatusFiring || n.Label != "brisket" || n.DeviceUUID != "device-a" {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+}
+
+func TestEngineReturnsNotifierErrors(t *testing.T) {
+	notifier := &recordingNotifier{err: errors.New("unreachable")}
+	engine, err := NewEngine([]Rule{{Name: "hot", Above: float(100)}}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.Evaluate(context.Background(), []Reading{{Channel: 1, Celsius: 120, Time: time.Now()}})
+	if err == nil {
+		t.Error("expected the notifier error")
+	}
+}
+
+func TestNewEngineRejectsInvalidRules(t *testing.T) {
+	for name, rules := range map[string][]Rule{
+		"no name":      {{Above: float(1)}},
+		"no threshold": {{Name: "a"}},
+		"bad unit":     {{Name: "a", Above: float(1), Unit: "K"}},
+		"duplicate":    {{Name: "a", Above: float(1)}, {Name: "a", Below: float(1)}},
+	} {
+		if _, err := NewEngine(rules, &recordingNotifier{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"name": "pit", "device": "Smoker", "channel": "Pit", "unit": "F", "below": 225, "above": 275, "for": "10m", "hysteresis": 5, "cooldown": "1h"}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("got %d rules, want 1", len(rules))
+	}
+	r := rules[0]
+	if r.Name != "pit" || *r.Below != 225 || *r.Above != 275 || time.Duration(r.For) != 10*time.Minute || time.Duration(r.Cooldown) != time.Hour || r.Hysteresis != 5 {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"name": "pit", "for": "ten minutes"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(path); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
+
+func TestEngineRetriesFailedNotifications(t *testing.T) {
+	notifier := &recordingNotifier{err: errors.New("unreachable")}
+	engine, err := NewEngine([]Rule{{Name: "hot", Above: float(100), Hysteresis: 5, Cooldown: Duration(time.Hour)}}, notifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	evaluate := func(minutes int, celsius float64) error {
+		return engine.Evaluate(context.Background(), []Reading{{Channel: 1, Celsius: celsius, Time: start.Add(time.Duration(minutes) * time.Minute)}})
+	}
+
+	if err := evaluate(0, 120); err == nil {
+		t.Fatal("expected the delivery to fail")
+	}
+	notifier.err = nil
+	// the failed firing is sent again and its cooldown only starts once delivered
+	if err := evaluate(1, 120); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifier.statuses(); len(got) != 2 || got[1] != StatusFiring {
+		t.Fatalf("got %v, want the firing resent", got)
+	}
+
+	notifier.err = errors.New("unreachable")
+	evaluate(2, 80)
+	notifier.err = nil
+	if err := evaluate(3, 80); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifier.statuses(); len(got) != 4 || got[3] != StatusResolved {
+		t.Fatalf("got %v, want the resolve resent", got)
+	}
+	if err := evaluate(4, 120); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifier.statuses(); len(got) != 4 {
+		t.Errorf("got %v, want no firing within the cooldown of the delivered firing", got)
+	}
+}
+
+func TestEngineTracksDeliveryPerNotifier(t *testing.T) {
+	webhook := &recordingNotifier{}
+	email := &recordingNotifier{err: errors.New("smtp unavailable")}
+	engine, err := NewEngine([]Rule{{Name: "hot", Above: float(100)}}, MultiNotifier(webhook, email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	evaluate := func(minutes int, celsius float64) error {
+		return engine.Evaluate(context.Background(), []Reading{{Channel: 1, Celsius: celsius, Time: start.Add(time.Duration(minutes) * time.Minute)}})
+	}
+
+	for minutes := 0; minutes < 3; minutes++ {
+		if err := evaluate(minutes, 120); err == nil {
+			t.Fatal("expected the email delivery to fail")
+		}
+	}
+	if got := webhook.statuses(); len(got) != 1 {
+		t.Errorf("webhook: got %v, want the firing delivered once", got)
+	}
+	if got := email.statuses(); len(got) != 3 {
+		t.Errorf("email: got %v, want the firing tried by every evaluation", got)
+	}
+
+	email.err = nil
+	if err := evaluate(3, 80); err != nil {
+		t.Fatal(err)
+	}
+	if got := webhook.statuses(); len(got) != 2 || got[1] != StatusResolved {
+		t.Errorf("webhook: got %v, want the resolve", got)
+	}
+	// the email never delivered the firing, so there is nothing to resolve
+	if got := email.statuses(); len(got) != 3 {
+		t.Errorf("email: got %v, want no resolve", got)
+	}
+}
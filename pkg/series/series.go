@@ -0,0 +1,182 @@
+package series
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/platinummonkey/fireboard-datadog-integration/pkg/intake"
+)
+
+const (
+	// DefaultSite is the Datadog site used when none is configured
+	DefaultSite = intake.DefaultSite
+	// DefaultBatchSize is the number of points sent in a single request
+	DefaultBatchSize = 1000
+
+	seriesAPIPath  = "/api/v2/series"
+	defaultTimeout = 30 * time.Second
+
+	// metricTypeGauge is the v2 series api intake type for gauges
+	metricTypeGauge = 3
+)
+
+// Point is a single value at the time it was measured.
+type Point struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// Series is a gauge metric with its points and tags.
+type Series struct {
+	Metric string
+	Points []Point
+	Tags   []string
+}
+
+// Sink submits series with their own timestamps, unlike statsd which stamps every value with the time it is received.
+type Sink interface {
+	// Submit sends the series in batches, it attempts every batch and returns the errors of the failed ones joined.
+	Submit(ctx context.Context, series []Series) error
+}
+
+type httpSink struct {
+	baseURL    string
+	apiKey     string
+	batchSize  int
+	httpClient *http.Client
+}
+
+// NewHTTPSink returns a sink submitting to the Datadog v2 series api of site, e.g. datadoghq.com or datadoghq.eu.
+func NewHTTPSink(apiKey, site string) *httpSink {
+	if site == "" {
+		site = DefaultSite
+	}
+	return &httpSink{
+		baseURL:    "https://api." + site,
+		apiKey:     apiKey,
+		batchSize:  DefaultBatchSize,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// NewHTTPSinkFromEnv returns a sink configured from DD_API_KEY, DD_SITE, FIREBOARD_SERIES_URL and FIREBOARD_SERIES_BATCH_SIZE.
+func NewHTTPSinkFromEnv() (*httpSink, error) {
+	apiKey := os.Getenv("DD_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("DD_API_KEY is required to submit series")
+	}
+	sink := NewHTTPSink(apiKey, os.Getenv("DD_SITE"))
+	if val, ok := os.LookupEnv("FIREBOARD_SERIES_URL"); ok && val != "" {
+		sink.SetBaseURL(val)
+	}
+	if val, ok := os.LookupEnv("FIREBOARD_SERIES_BATCH_SIZE"); ok {
+		if size, err := strconv.Atoi(val); err == nil {
+			sink.SetBatchSize(size)
+		}
+	}
+	return sink, nil
+}
+
+// SetBaseURL overrides the url derived from the site, e.g. to submit through a proxy.
+func (s *httpSink) SetBaseURL(url string) {
+	s.baseURL = strings.TrimSuffix(url, "/")
+}
+
+// GetBaseURL returns the url series are submitted to.
+func (s *httpSink) GetBaseURL() string {
+	return s.baseURL
+}
+
+// SetBatchSize sets the maximum number of points per request, values below one use DefaultBatchSize.
+func (s *httpSink) SetBatchSize(size int) {
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	s.batchSize = size
+}
+
+// SetTimeout sets the timeout for each request.
+func (s *httpSink) SetTimeout(timeout time.Duration) {
+	s.httpClient.Timeout = timeout
+}
+
+type intakePoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+type intakeSeries struct {
+	Metric string        `json:"metric"`
+	Type   int           `json:"type"`
+	Points []intakePoint `json:"points"`
+	Tags   []string      `json:"tags,omitempty"`
+}
+
+type intakePayload struct {
+	Series []intakeSeries `json:"series"`
+}
+
+type intakeResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// batches splits series into payloads of at most size points, long series are split across payloads.
+func batches(series []Series, size int) []intakePayload {
+	var out []intakePayload
+	var current intakePayload
+	points := 0
+	for _, s := range series {
+		for start := 0; start < len(s.Points); {
+			if points == size {
+				out = append(out, current)
+				current = intakePayload{}
+				points = 0
+			}
+			end := start + size - points
+			if end > len(s.Points) {
+				end = len(s.Points)
+			}
+			intake := intakeSeries{Metric: s.Metric, Type: metricTypeGauge, Tags: s.Tags}
+			for _, p := range s.Points[start:end] {
+				intake.Points = append(intake.Points, intakePoint{Timestamp: p.Timestamp.Unix(), Value: p.Value})
+			}
+			current.Series = append(current.Series, intake)
+			points += end - start
+			start = end
+		}
+	}
+	if points > 0 {
+		out = append(out, current)
+	}
+	return out
+}
+
+func (s *httpSink) Submit(ctx context.Context, series []Series) error {
+	var errs []error
+	for _, payload := range batches(series, s.batchSize) {
+		if err := s.post(ctx, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// post sends a single gzip compressed payload.
+func (s *httpSink) post(ctx context.Context, payload intakePayload) error {
+	data, err := intake.Post(ctx, s.httpClient, s.baseURL+seriesAPIPath, s.apiKey, "series api", payload)
+	if err != nil {
+		return err
+	}
+	var resp intakeResponse
+	if len(data) > 0 && json.Unmarshal(data, &resp) == nil && len(resp.Errors) > 0 {
+		return fmt.Errorf("series api rejected the payload: %s", strings.Join(resp.Errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package series
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// intakeServer is a local stand-in for the Datadog series api recording each decoded payload.
+type intakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	payloads []intakePayload
+	status   int
+	response string
+}
+
+func newIntakeServer(t *testing.T) *intakeServer {
+	s := &intakeServer{status: http.StatusAccepted, response: `{"errors":[]}`}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != seriesAPIPath {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("DD-API-KEY"); got != "test-key" {
+			t.Errorf("api key header: got %q", got)
+		}
+		if got := r.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Errorf("content encoding: got %q", got)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("body is not gzip: %v", err)
+			return
+		}
+		var payload intakePayload
+		if err := json.NewDecoder(zr).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		s.mu.Lock()
+		s.payloads = append(s.payloads, payload)
+		s.mu.Unlock()
+		w.WriteHeader(s.status)
+		w.Write([]byte(s.response))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testSeries(metric string, start time.Time, n int) Series {
+	s := Series{Metric: metric, Tags: []string{"sessionID:1"}}
+	for i := 0; i < n; i++ {
+		s.Points = append(s.Points, Point{Timestamp: start.Add(time.Duration(i) * time.Minute), Value: float64(i)})
+	}
+	return s
+}
+
+func TestSubmitBatchesWithRealTimestamps(t *testing.T) {
+	server := newIntakeServer(t)
+	sink := NewHTTPSink("test-key", "")
+	sink.SetBaseURL(server.URL)
+	sink.SetBatchSize(3)
+
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	err := sink.Submit(context.Background(), []Series{
+		testSeries("fireboard.sessions.chart", start, 4),
+		testSeries("fireboard.sessions.chart", start, 1),
+		{Metric: "fireboard.empty"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.payloads) != 2 {
+		t.Fatalf("got %d requests, want 2", len(server.payloads))
+	}
+	var timestamps []int64
+	for i, payload := range server.payloads {
+		points := 0
+		for _, s := range payload.Series {
+			if s.Type != metricTypeGauge || s.Metric != "fireboard.sessions.chart" || len(s.Tags) != 1 {
+				t.Errorf("unexpected series %+v", s)
+			}
+			points += len(s.Points)
+			for _, p := range s.Points {
+				timestamps = append(timestamps, p.Timestamp)
+			}
+		}
+		if points > 3 {
+			t.Errorf("request %d has %d points, want at most 3", i, points)
+		}
+	}
+	want := []int64{start.Unix(), start.Unix() + 60, start.Unix() + 120, start.Unix() + 180, start.Unix()}
+	if len(timestamps) != len(want) {
+		t.Fatalf("got timestamps %v, want %v", timestamps, want)
+	}
+	for i := range want {
+		if timestamps[i] != want[i] {
+			t.Errorf("point %d: got timestamp %d, want %d", i, timestamps[i], want[i])
+		}
+	}
+}
+
+func TestSubmitReturnsIntakeErrors(t *testing.T) {
+	server := newIntakeServer(t)
+	sink := NewHTTPSink("test-key", "")
+	sink.SetBaseURL(server.URL)
+
+	series := []Series{testSeries("fireboard.sessions.chart", time.Now(), 1)}
+	server.status = http.StatusForbidden
+	server.response = `{"errors":["Forbidden"]}`
+	if err := sink.Submit(context.Background(), series); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want a 403 error", err)
+	}
+
+	server.status = http.StatusAccepted
+	server.response = `{"errors":["Point timestamp is too old"]}`
+	if err := sink.Submit(context.Background(), series); err == nil || !strings.Contains(err.Error(), "too old") {
+		t.Errorf("got %v, want the intake error", err)
+	}
+}
+
+func TestSubmitJoinsBatchErrors(t *testing.T) {
+	server := newIntakeServer(t)
+	sink := NewHTTPSink("test-key", "")
+	sink.SetBaseURL(server.URL)
+	sink.SetBatchSize(1)
+
+	server.status = http.StatusForbidden
+	server.response = `{"errors":["Forbidden"]}`
+	err := sink.Submit(context.Background(), []Series{testSeries("fireboard.sessions.chart", time.Now(), 2)})
+	if err == nil || strings.Count(err.Error(), "403") != 2 {
+		t.Errorf("got %v, want the error of both batches", err)
+	}
+}
+
+func TestNewHTTPSinkSite(t *testing.T) {
+	if got := NewHTTPSink("key", "").GetBaseURL(); got != "https://api.datadoghq.com" {
+		t.Errorf("default site: got %s", got)
+	}
+	if got := NewHTTPSink("key", "datadoghq.eu").GetBaseURL(); got != "https://api.datadoghq.eu" {
+		t.Errorf("eu site: got %s", got)
+	}
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	serviceName = "fireboard-datadog-integration"
+
+	// ExporterNone disables tracing
+	ExporterNone = ""
+	// ExporterOTLP exports to an OTLP/HTTP collector, configured with the standard OTEL_EXPORTER_OTLP_* variables
+	// and defaulting to localhost:4318
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans as json to stdout
+	ExporterStdout = "stdout"
+)
+
+// ShutdownFunc flushes and stops the tracer provider.
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup installs a global tracer provider exporting to exporter, one of the Exporter* constants.
+// The api client and collector trace through the global provider so no spans are recorded until this is called.
+func Setup(ctx context.Context, exporter string) (ShutdownFunc, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// SetupFromEnv calls Setup with the exporter named by FIREBOARD_TRACE_EXPORTER.
+func SetupFromEnv(ctx context.Context) (ShutdownFunc, error) {
+	return Setup(ctx, os.Getenv("FIREBOARD_TRACE_EXPORTER"))
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// restoreGlobals puts back the global tracer provider and propagator once the test ends.
+func restoreGlobals(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		// setting the defaults to themselves logs an error
+		if otel.GetTracerProvider() != provider {
+			otel.SetTracerProvider(provider)
+		}
+		if otel.GetTextMapPropagator() != propagator {
+			otel.SetTextMapPropagator(propagator)
+		}
+	})
+}
+
+func TestSetupNoneKeepsTracingDisabled(t *testing.T) {
+	restoreGlobals(t)
+	before := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), ExporterNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otel.GetTracerProvider() != before {
+		t.Error("a tracer provider was installed with tracing disabled")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetupInstallsTracerProvider(t *testing.T) {
+	for _, exporter := range []string{ExporterStdout, ExporterOTLP} {
+		t.Run(exporter, func(t *testing.T) {
+			restoreGlobals(t)
+			shutdown, err := Setup(context.Background(), exporter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); !ok {
+				t.Errorf("got %T, want the sdk tracer provider", otel.GetTracerProvider())
+			}
+			if fields := otel.GetTextMapPropagator().Fields(); len(fields) == 0 || fields[0] != "traceparent" {
+				t.Errorf("got propagator fields %v, want trace context", fields)
+			}
+			// nothing was recorded so shutting down does not export
+			if err := shutdown(context.Background()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	restoreGlobals(t)
+	if _, err := Setup(context.Background(), "zipkin"); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
+
+func TestSetupFromEnv(t *testing.T) {
+	restoreGlobals(t)
+	t.Setenv("FIREBOARD_TRACE_EXPORTER", "jaeger")
+	if _, err := SetupFromEnv(context.Background()); err == nil {
+		t.Error("expected FIREBOARD_TRACE_EXPORTER to be used")
+	}
+	t.Setenv("FIREBOARD_TRACE_EXPORTER", ExporterStdout)
+	shutdown, err := SetupFromEnv(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); !ok {
+		t.Errorf("got %T, want the sdk tracer provider", otel.GetTracerProvider())
+	}
+}